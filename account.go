@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"sort"
+	"sync"
+	"time"
+)
+
+const accountBalanceExpiry = 10 * time.Second
+
+var (
+	errInsufficientBalance = errors.New("insufficient balance")
+	errRefundExceeded      = errors.New("refund exceeds invoice amount")
+)
+
+type AccountWithdrawalId string
+
+type AccountWithdrawal struct {
+	Id         AccountWithdrawalId `json:"-"`
+	Owner      UserKey             `json:"owner"`
+	Target     string              `json:"target,omitempty"`
+	Amount     int64               `json:"amount" binding:"min=1"`
+	MaxFee     int64               `json:"maxFee,omitempty"`
+	Split      bool                `json:"split,omitempty"`
+	Refund     PaymentHash         `json:"refund,omitempty"`
+	Card       CardId              `json:"card,omitempty"`
+	Created    time.Time           `json:"created"`
+	Approver   UserKey             `json:"approver,omitempty"`
+	Canceled   bool                `json:"canceled,omitempty"`
+	Withdrawal *Withdrawal         `json:"-"`
+}
+
+func (withdrawal *AccountWithdrawal) IsForward() bool {
+	return withdrawal.Target != ""
+}
+
+func (withdrawal *AccountWithdrawal) IsRefund() bool {
+	return withdrawal.Refund != ""
+}
+
+func (withdrawal *AccountWithdrawal) IsCardPayment() bool {
+	return withdrawal.Card != ""
+}
+
+func (withdrawal *AccountWithdrawal) IsApproved() bool {
+	return withdrawal.Approver != "" || withdrawal.IsForward()
+}
+
+func (withdrawal *AccountWithdrawal) IsWithdrawable() bool {
+	return !withdrawal.IsForward() && !withdrawal.IsCardPayment() && withdrawal.IsApproved() && withdrawal.IsCancelable()
+}
+
+func (withdrawal *AccountWithdrawal) isInProgress() bool {
+	return withdrawal.Withdrawal != nil && !withdrawal.Withdrawal.isFinal()
+}
+
+func (withdrawal *AccountWithdrawal) isOutstanding() bool {
+	return !withdrawal.Canceled && (withdrawal.Withdrawal == nil || !withdrawal.Withdrawal.IsSucceeded())
+}
+
+func (withdrawal *AccountWithdrawal) IsCancelable() bool {
+	return !withdrawal.Canceled && isWithdrawable(withdrawal.Withdrawal)
+}
+
+// withdrawalApprover returns the user a new withdrawal is approved by right away, if any;
+// withdrawals requiring approval are only approved by administrators themselves.
+func withdrawalApprover(account *Account, user UserKey, administrator bool) UserKey {
+	if !account.Withdrawal.RequiresApproval || administrator {
+		return user
+	}
+	return ""
+}
+
+type AccountBalance struct {
+	amount  int64
+	version int64
+}
+
+type AccountService struct {
+	accounts          map[AccountKey]Account
+	balances          *expirable.LRU[AccountKey, AccountBalance]
+	repository        *Repository
+	lndClient         *LndClient
+	withdrawalService *WithdrawalService
+	onChainService    *OnChainService
+	mutex             sync.Mutex
+}
+
+func newAccountService(accounts map[AccountKey]Account, repository *Repository, lndClient *LndClient,
+	withdrawalService *WithdrawalService, onChainService *OnChainService) *AccountService {
+
+	return &AccountService{
+		accounts:          accounts,
+		balances:          expirable.NewLRU[AccountKey, AccountBalance](64, nil, accountBalanceExpiry),
+		repository:        repository,
+		lndClient:         lndClient,
+		withdrawalService: withdrawalService,
+		onChainService:    onChainService,
+	}
+}
+
+// getBalance caches balances until the repository records a change; settled invoices and on-chain payments
+// are only reflected once the cached balance expires.
+func (service *AccountService) getBalance(accountKey AccountKey) int64 {
+	version := service.repository.getBalancesVersion()
+	if balance, cached := service.balances.Get(accountKey); cached && balance.version == version {
+		return balance.amount
+	}
+
+	amount := service.computeBalance(accountKey)
+	service.balances.Add(accountKey, AccountBalance{amount, version})
+
+	return amount
+}
+
+func (service *AccountService) computeBalance(accountKey AccountKey) int64 {
+	var balance int64
+	for _, paymentHash := range service.repository.getAllAccountInvoices(accountKey) {
+		invoice := service.lndClient.getInvoice(paymentHash)
+		if invoice != nil && invoice.isSettled() {
+			balance += invoice.amount
+		}
+	}
+
+	for _, payment := range service.onChainService.getPayments(accountKey) {
+		if payment.IsConfirmed {
+			balance += payment.Received
+		}
+	}
+
+	for _, batch := range service.repository.getVoucherBatches() {
+		if batch.AccountKey == accountKey {
+			balance -= batch.total()
+		}
+	}
+
+	for _, withdrawal := range service.repository.getAccountWithdrawals(accountKey) {
+		if !withdrawal.Canceled && !withdrawal.Split {
+			balance -= withdrawal.Amount
+		}
+	}
+
+	for _, entry := range service.repository.getAccountLedgerEntries(accountKey) {
+		balance -= entry.amount
+	}
+	for _, amount := range service.getIncomingSplits(accountKey) {
+		balance += amount
+	}
+
+	return balance - service.getUnsplitShares(accountKey)
+}
+
+// getUnsplitShares reserves split shares of settled invoices until they get recorded in the ledger.
+func (service *AccountService) getUnsplitShares(accountKey AccountKey) int64 {
+	splits := service.accounts[accountKey].Splits
+	if len(splits) == 0 {
+		return 0
+	}
+	ledger := service.repository.getAccountLedger(accountKey)
+	if ledger == nil {
+		return 0
+	}
+
+	var shares int64
+	for _, invoice := range getUnsplitInvoices(service.repository, service.lndClient, accountKey, ledger) {
+		for _, split := range splits {
+			shares += split.share(invoice.amount)
+		}
+	}
+
+	return shares
+}
+
+func (service *AccountService) getIncomingSplits(accountKey AccountKey) map[AccountKey]int64 {
+	incomingSplits := map[AccountKey]int64{}
+	for _, sourceAccountKey := range service.repository.getAccountKeys() {
+		for _, entry := range service.repository.getAccountLedgerEntries(sourceAccountKey) {
+			if entry.account == accountKey {
+				incomingSplits[sourceAccountKey] += entry.amount
+			}
+		}
+	}
+
+	return incomingSplits
+}
+
+func (service *AccountService) createWithdrawal(accountKey AccountKey, withdrawal *AccountWithdrawal) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if withdrawal.Amount > service.getBalance(accountKey) {
+		return errInsufficientBalance
+	}
+
+	withdrawal.Created = time.Now()
+	return service.repository.createAccountWithdrawal(accountKey, withdrawal)
+}
+
+func (service *AccountService) createVoucherBatch(batch *VoucherBatch, vouchers []Voucher) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if batch.total() > service.getBalance(batch.AccountKey) {
+		return errInsufficientBalance
+	}
+
+	batch.Created = time.Now()
+	return service.repository.createVoucherBatch(batch, vouchers)
+}
+
+func (service *AccountService) getRefunds(accountKey AccountKey) map[PaymentHash]int64 {
+	refunds := map[PaymentHash]int64{}
+	for _, withdrawal := range service.repository.getAccountWithdrawals(accountKey) {
+		if withdrawal.IsRefund() && !withdrawal.Canceled {
+			refunds[withdrawal.Refund] += withdrawal.Amount
+		}
+	}
+
+	return refunds
+}
+
+func (service *AccountService) createRefund(accountKey AccountKey, invoice *Invoice, withdrawal *AccountWithdrawal) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if withdrawal.Amount > invoice.amount-service.getRefunds(accountKey)[invoice.paymentHash] {
+		return errRefundExceeded
+	}
+	if withdrawal.Amount > service.getBalance(accountKey) {
+		return errInsufficientBalance
+	}
+
+	withdrawal.Refund = invoice.paymentHash
+	withdrawal.Created = time.Now()
+	return service.repository.createAccountWithdrawal(accountKey, withdrawal)
+}
+
+func (service *AccountService) getWithdrawal(accountKey AccountKey, withdrawalId AccountWithdrawalId) *AccountWithdrawal {
+	withdrawal := service.repository.getAccountWithdrawal(accountKey, withdrawalId)
+	if withdrawal != nil {
+		withdrawal.Withdrawal = service.withdrawalService.getWithdrawal(
+			service.repository.getAccountWithdrawalFileName(accountKey, withdrawal),
+		)
+	}
+
+	return withdrawal
+}
+
+func (service *AccountService) getWithdrawals(accountKey AccountKey) []*AccountWithdrawal {
+	withdrawals := service.repository.getAccountWithdrawals(accountKey)
+	for _, withdrawal := range withdrawals {
+		withdrawal.Withdrawal = service.withdrawalService.getWithdrawal(
+			service.repository.getAccountWithdrawalFileName(accountKey, withdrawal),
+		)
+	}
+
+	return sortAccountWithdrawals(withdrawals)
+}
+
+func (service *AccountService) approveWithdrawal(accountKey AccountKey, withdrawal *AccountWithdrawal, approver UserKey) error {
+	withdrawal.Approver = approver
+	return service.repository.updateAccountWithdrawal(accountKey, withdrawal)
+}
+
+func (service *AccountService) cancelWithdrawal(accountKey AccountKey, withdrawal *AccountWithdrawal) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	fileName := service.repository.getAccountWithdrawalFileName(accountKey, withdrawal)
+	return service.withdrawalService.cancel(fileName, func() error {
+		withdrawal.Canceled = true
+		return service.repository.updateAccountWithdrawal(accountKey, withdrawal)
+	})
+}
+
+func (service *AccountService) createWithdrawalRequest(accountKey AccountKey, account *Account, withdrawal *AccountWithdrawal) string {
+	description := account.Description
+	if withdrawal.IsRefund() {
+		description = "Refund: " + description
+	}
+
+	request := service.withdrawalService.newRequest(
+		service.repository.getAccountWithdrawalFileName(accountKey, withdrawal),
+		withdrawal.Amount,
+		description,
+		accountKey,
+	)
+	request.isCanceled = func() bool {
+		withdrawal := service.repository.getAccountWithdrawal(accountKey, withdrawal.Id)
+		return withdrawal == nil || withdrawal.Canceled
+	}
+
+	return service.withdrawalService.addRequest(request)
+}
+
+func sortAccountWithdrawals(withdrawals []*AccountWithdrawal) []*AccountWithdrawal {
+	sort.Slice(withdrawals, func(i, j int) bool {
+		return withdrawals[i].Created.After(withdrawals[j].Created)
+	})
+	return withdrawals
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/hashicorp/golang-lru/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAccountWithdrawal(t *testing.T) {
+	withdrawal := AccountWithdrawal{Owner: "barista", Amount: 21_000}
+	assert.False(t, withdrawal.IsApproved())
+	assert.False(t, withdrawal.IsWithdrawable())
+	assert.True(t, withdrawal.IsCancelable())
+
+	withdrawal.Approver = "admin"
+	assert.True(t, withdrawal.IsWithdrawable())
+
+	withdrawal.Withdrawal = &Withdrawal{State: WithdrawalInFlight}
+	assert.False(t, withdrawal.IsWithdrawable())
+	assert.False(t, withdrawal.IsCancelable())
+
+	withdrawal.Withdrawal.State = WithdrawalFailed
+	assert.True(t, withdrawal.IsWithdrawable())
+
+	withdrawal.Canceled = true
+	assert.False(t, withdrawal.IsWithdrawable())
+	assert.False(t, withdrawal.IsCancelable())
+}
+
+func TestWithdrawalApprover(t *testing.T) {
+	account := Account{}
+	assert.Equal(t, UserKey("barista"), withdrawalApprover(&account, "barista", false))
+	assert.Equal(t, UserKey("admin"), withdrawalApprover(&account, "admin", true))
+
+	account.Withdrawal.RequiresApproval = true
+	assert.Equal(t, UserKey(""), withdrawalApprover(&account, "barista", false))
+	assert.Equal(t, UserKey("admin"), withdrawalApprover(&account, "admin", true))
+}
+
+func TestAccountService(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	withdrawalService := newWithdrawalService(
+		WithdrawalConfig{FeePercent: 1, RequestExpiry: 1 * time.Minute}, repository, nil,
+	)
+	service := newAccountService(nil, repository, nil, withdrawalService, newOnChainService(repository, nil))
+
+	assert.Empty(t, service.getWithdrawals("cafe"))
+	assert.ErrorIs(t, service.createWithdrawal("cafe", &AccountWithdrawal{Amount: 1}), errInsufficientBalance)
+
+	older := AccountWithdrawal{Owner: "barista", Amount: 2_100, Created: time.Unix(1700000000, 0)}
+	newer := AccountWithdrawal{Owner: "barista", Amount: 4_200, Created: time.Unix(1700000021, 0)}
+	assert.NoError(t, repository.createAccountWithdrawal("cafe", &older))
+	assert.NoError(t, repository.createAccountWithdrawal("cafe", &newer))
+	assert.Equal(t, int64(-6_300), service.getBalance("cafe"))
+
+	withdrawals := service.getWithdrawals("cafe")
+	assert.Len(t, withdrawals, 2)
+	assert.Equal(t, newer.Id, withdrawals[0].Id)
+	assert.Equal(t, older.Id, withdrawals[1].Id)
+
+	t.Run("approveWithdrawal", func(t *testing.T) {
+		assert.NoError(t, service.approveWithdrawal("cafe", &older, "admin"))
+		assert.True(t, service.getWithdrawal("cafe", older.Id).IsWithdrawable())
+	})
+
+	t.Run("createWithdrawalRequest", func(t *testing.T) {
+		k1 := service.createWithdrawalRequest("cafe", &Account{Description: "Café"}, &older)
+		request := withdrawalService.getRequest(k1)
+		assert.Equal(t, int64(2_079), request.amount)
+		assert.Equal(t, "Café", request.description)
+		assert.Equal(t, AccountKey("cafe"), request.accountKey)
+		assert.Equal(t, repository.getAccountWithdrawalFileName("cafe", &older), request.fileName)
+	})
+
+	t.Run("cancelWithdrawal", func(t *testing.T) {
+		k1 := service.createWithdrawalRequest("cafe", &Account{}, &newer)
+		request := withdrawalService.getRequest(k1)
+		assert.NoError(t, service.cancelWithdrawal("cafe", &newer))
+		assert.Nil(t, withdrawalService.getRequest(k1))
+		assert.False(t, service.getWithdrawal("cafe", newer.Id).IsCancelable())
+		assert.Equal(t, int64(-2_100), service.getBalance("cafe"))
+
+		_, err := withdrawalService.startWithdrawal(request, "")
+		assert.ErrorIs(t, err, errWithdrawalCanceled)
+	})
+
+	t.Run("cancelStartedWithdrawal", func(t *testing.T) {
+		k1 := service.createWithdrawalRequest("cafe", &Account{}, &older)
+		_, err := withdrawalService.startWithdrawal(withdrawalService.getRequest(k1), "")
+		assert.NoError(t, err)
+		assert.ErrorIs(t, service.cancelWithdrawal("cafe", &older), errAlreadyWithdrawn)
+		assert.False(t, service.getWithdrawal("cafe", older.Id).Canceled)
+	})
+
+	assert.Nil(t, service.getWithdrawal("cafe", "invalid"))
+}
+
+func TestAccountRefunds(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	withdrawalService := newWithdrawalService(WithdrawalConfig{RequestExpiry: 1 * time.Minute}, repository, nil)
+	service := newAccountService(nil, repository, nil, withdrawalService, newOnChainService(repository, nil))
+	invoice := Invoice{paymentHash: "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d", amount: 6_000}
+
+	assert.ErrorIs(t, service.createRefund("shop", &invoice, &AccountWithdrawal{Amount: 1}), errInsufficientBalance)
+	assert.NoError(t, repository.createAccountLedger("bakery", &AccountLedger{}))
+	assert.NoError(t, repository.addAccountLedgerEntry("bakery", LedgerEntry{amount: 10_000, account: "shop"}))
+
+	refund := AccountWithdrawal{Owner: "barista", Amount: 4_000, Approver: "barista"}
+	assert.NoError(t, service.createRefund("shop", &invoice, &refund))
+	assert.True(t, refund.IsRefund())
+	assert.True(t, refund.IsWithdrawable())
+	assert.ErrorIs(t, service.createRefund("shop", &invoice, &AccountWithdrawal{Amount: 2_001}), errRefundExceeded)
+	assert.NoError(t, service.createRefund("shop", &invoice, &AccountWithdrawal{Amount: 2_000}))
+	assert.Equal(t, map[PaymentHash]int64{invoice.paymentHash: 6_000}, service.getRefunds("shop"))
+	assert.Equal(t, int64(4_000), service.getBalance("shop"))
+
+	assert.NoError(t, service.cancelWithdrawal("shop", &refund))
+	assert.Equal(t, int64(2_000), service.getRefunds("shop")[invoice.paymentHash])
+}
+
+func TestAccountBalanceCache(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	invoices, _ := lru.New[PaymentHash, Invoice](8)
+	withdrawalService := newWithdrawalService(WithdrawalConfig{RequestExpiry: 1 * time.Minute}, repository, nil)
+	service := newAccountService(nil, repository, &LndClient{invoices: invoices}, withdrawalService, newOnChainService(repository, nil))
+	invoice := Invoice{paymentHash: "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d", amount: 6_000}
+
+	invoices.Add(invoice.paymentHash, invoice)
+	assert.NoError(t, repository.addAccountInvoice("shop", &invoice))
+	assert.Equal(t, int64(0), service.getBalance("shop"))
+	invoice.settleDate = time.Now()
+	invoices.Add(invoice.paymentHash, invoice)
+	assert.Equal(t, int64(0), service.getBalance("shop"))
+
+	assert.NoError(t, repository.createAccountLedger("bakery", &AccountLedger{}))
+	assert.Equal(t, int64(6_000), service.getBalance("shop"))
+	withdrawal := AccountWithdrawal{Amount: 4_000}
+	assert.NoError(t, service.createWithdrawal("shop", &withdrawal))
+	assert.Equal(t, int64(2_000), service.getBalance("shop"))
+	assert.ErrorIs(t, service.createWithdrawal("shop", &AccountWithdrawal{Amount: 2_001}), errInsufficientBalance)
+	assert.NoError(t, service.cancelWithdrawal("shop", &withdrawal))
+	assert.Equal(t, int64(6_000), service.getBalance("shop"))
+}
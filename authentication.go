@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
@@ -9,9 +10,24 @@ import (
 	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/mr-tron/base58"
 	"log"
+	"regexp"
+	"sync"
 	"time"
 )
 
+const (
+	maxPinAttempts         = 5
+	maxOperatorPinAttempts = 50
+	pinLockout             = 15 * time.Minute
+)
+
+var pinRegexp = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+var (
+	errInvalidPin         = errors.New("invalid operator or PIN")
+	errTooManyPinAttempts = errors.New("too many PIN attempts")
+)
+
 type Identity string
 
 func toIdentity(value string) Identity {
@@ -33,13 +49,25 @@ type AuthenticationConfig struct {
 	RequestExpiry time.Duration `yaml:"request-expiry"`
 }
 
+type OperatorConfig struct {
+	Pin      string
+	Accounts []AccountKey
+}
+
 type AuthenticationService struct {
-	credentials map[UserKey]string
-	tokens      map[string]UserKey
-	k1s         *expirable.LRU[string, Identity]
+	credentials    map[UserKey]string
+	operators      map[UserKey]OperatorConfig
+	operatorTokens map[UserKey]string
+	tokens         map[string]UserKey
+	k1s            *expirable.LRU[string, Identity]
+	pinFailures    *expirable.LRU[UserKey, int]
+	clientFailures *expirable.LRU[string, int]
+	mutex          sync.Mutex
 }
 
-func newAuthenticationService(credentials map[UserKey]string, config AuthenticationConfig) *AuthenticationService {
+func newAuthenticationService(credentials map[UserKey]string, operators map[UserKey]OperatorConfig, secret []byte,
+	config AuthenticationConfig) *AuthenticationService {
+
 	if len(credentials) == 0 {
 		log.Fatal("Authentication credentials missing")
 	}
@@ -53,11 +81,20 @@ func newAuthenticationService(credentials map[UserKey]string, config Authenticat
 	for user, password := range credentials {
 		tokens[accessToken(user, password)] = user
 	}
+	operatorTokens := map[UserKey]string{}
+	for operator, operatorConfig := range operators {
+		operatorTokens[operator] = operatorToken(secret, operator, operatorConfig.Pin)
+		tokens[operatorTokens[operator]] = operator
+	}
 
 	return &AuthenticationService{
-		credentials: credentials,
-		tokens:      tokens,
-		k1s:         expirable.NewLRU[string, Identity](1024, nil, requestExpiry),
+		credentials:    credentials,
+		operators:      operators,
+		operatorTokens: operatorTokens,
+		tokens:         tokens,
+		k1s:            expirable.NewLRU[string, Identity](1024, nil, requestExpiry),
+		pinFailures:    expirable.NewLRU[UserKey, int](1024, nil, pinLockout),
+		clientFailures: expirable.NewLRU[string, int](4096, nil, pinLockout),
 	}
 }
 
@@ -66,6 +103,31 @@ func (service *AuthenticationService) verifyCredentials(user UserKey, password s
 	return userExists && password == userPassword
 }
 
+func (service *AuthenticationService) verifyPin(operator UserKey, pin string, client string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	clientFailures, _ := service.clientFailures.Get(client)
+	operatorFailures, _ := service.pinFailures.Get(operator)
+	if clientFailures >= maxPinAttempts || operatorFailures >= maxOperatorPinAttempts {
+		return errTooManyPinAttempts
+	}
+
+	operatorConfig, operatorExists := service.operators[operator]
+	if !operatorExists || pin != operatorConfig.Pin {
+		if client != "" {
+			service.clientFailures.Add(client, clientFailures+1)
+		}
+		if operatorExists {
+			service.pinFailures.Add(operator, operatorFailures+1)
+		}
+		return errInvalidPin
+	}
+
+	service.clientFailures.Remove(client)
+	return nil
+}
+
 func (service *AuthenticationService) getUser(token string) UserKey {
 	return service.tokens[token]
 }
@@ -74,7 +136,7 @@ func (service *AuthenticationService) getToken(user UserKey) string {
 	if password, userExists := service.credentials[user]; userExists {
 		return accessToken(user, password)
 	}
-	return ""
+	return service.operatorTokens[user]
 }
 
 func (service *AuthenticationService) generateChallenge() string {
@@ -109,6 +171,12 @@ func (service *AuthenticationService) getIdentity(k1 string) Identity {
 	return ""
 }
 
+func operatorToken(secret []byte, operator UserKey, pin string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("operator:" + string(operator) + ":" + pin))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
 func accessToken(user UserKey, password string) string {
 	hash := sha256.Sum256([]byte(string(user) + ":" + password))
 	return base64.StdEncoding.EncodeToString(hash[:])
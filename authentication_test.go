@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -16,6 +17,8 @@ func TestIdentity(t *testing.T) {
 func TestAuthenticationService(t *testing.T) {
 	service := newAuthenticationService(
 		map[UserKey]string{"satoshi": "4dm!nS3cr3t"},
+		map[UserKey]OperatorConfig{"alice": {Pin: "1234", Accounts: []AccountKey{"cafe"}}},
+		[]byte("s3cr3t"),
 		AuthenticationConfig{RequestExpiry: 1 * time.Minute},
 	)
 
@@ -26,16 +29,48 @@ func TestAuthenticationService(t *testing.T) {
 		assert.False(t, service.verifyCredentials("csw", "4dm!nS3cr3t"))
 		assert.False(t, service.verifyCredentials("", "4dm!nS3cr3t"))
 		assert.False(t, service.verifyCredentials("", ""))
+		assert.False(t, service.verifyCredentials("alice", "1234"))
+	})
+
+	t.Run("verifyPin", func(t *testing.T) {
+		assert.NoError(t, service.verifyPin("alice", "1234", "10.0.0.1"))
+		assert.ErrorIs(t, service.verifyPin("alice", "4321", "10.0.0.1"), errInvalidPin)
+		assert.ErrorIs(t, service.verifyPin("satoshi", "4dm!nS3cr3t", "10.0.0.1"), errInvalidPin)
+		assert.ErrorIs(t, service.verifyPin("", "", "10.0.0.1"), errInvalidPin)
+		for i := 3; i < maxPinAttempts; i++ {
+			assert.ErrorIs(t, service.verifyPin("bob", "0000", "10.0.0.1"), errInvalidPin)
+		}
+		assert.ErrorIs(t, service.verifyPin("alice", "1234", "10.0.0.1"), errTooManyPinAttempts)
+		assert.NoError(t, service.verifyPin("alice", "1234", "10.0.0.2"))
+		service.clientFailures.Remove("10.0.0.1")
+		assert.NoError(t, service.verifyPin("alice", "1234", "10.0.0.1"))
+
+		for i := 1; i < maxOperatorPinAttempts; i++ {
+			assert.ErrorIs(t, service.verifyPin("alice", "0000", strconv.Itoa(i)), errInvalidPin)
+		}
+		assert.ErrorIs(t, service.verifyPin("alice", "1234", "10.0.0.3"), errTooManyPinAttempts)
+		service.pinFailures.Remove("alice")
+		assert.NoError(t, service.verifyPin("alice", "1234", "10.0.0.3"))
+
+		for i := 0; i < maxPinAttempts; i++ {
+			assert.ErrorIs(t, service.verifyPin("bob", "0000", ""), errInvalidPin)
+		}
+		assert.NoError(t, service.verifyPin("alice", "1234", ""))
+		assert.False(t, service.clientFailures.Contains(""))
 	})
 
 	t.Run("getToken", func(t *testing.T) {
 		assert.Equal(t, "S5a4FZNT7zUF2u5nKX+Ksozcy4QSO9umR9SiwfIWaxQ=", service.getToken("satoshi"))
+		assert.Equal(t, "jQgdxYq6e7lm6vt3+BjiM8RjbQfQ9e01z0zbvB+NRpc=", service.getToken("alice"))
+		assert.NotEqual(t, accessToken("alice", "1234"), service.getToken("alice"))
 		assert.Empty(t, service.getToken("csw"))
 		assert.Empty(t, service.getToken(""))
 	})
 
 	t.Run("getUser", func(t *testing.T) {
 		assert.Equal(t, UserKey("satoshi"), service.getUser("S5a4FZNT7zUF2u5nKX+Ksozcy4QSO9umR9SiwfIWaxQ="))
+		assert.Equal(t, UserKey("alice"), service.getUser(operatorToken([]byte("s3cr3t"), "alice", "1234")))
+		assert.Empty(t, service.getUser(accessToken("alice", "1234")))
 		assert.Empty(t, service.getUser("S5a4FZNT7zUF2u5nKX+Ksozcy4QSO9umR9SiwfIWaxQ+"))
 		assert.Empty(t, service.getUser(""))
 	})
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fiatjaf/go-lnurl"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	bip353Label          = "user._bitcoin-payment"
+	bip353Ttl            = 3600
+	maxTxtStringLength   = 255
+	bitcoinUriPrefix     = "bitcoin:"
+	bip353OfferParam     = "lno"
+	bip353LnUrlParam     = "lnurl"
+	lightningOfferPrefix = "lno1"
+)
+
+var dnsLabelRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type Bip353Record struct {
+	name  string
+	value string
+}
+
+func (record Bip353Record) zoneLine() string {
+	var chunks []string
+	for value := record.value; value != ""; {
+		length := min(len(value), maxTxtStringLength)
+		chunks = append(chunks, `"`+value[:length]+`"`)
+		value = value[length:]
+	}
+	return fmt.Sprintf("%s %d IN TXT %s", record.name, bip353Ttl, strings.Join(chunks, " "))
+}
+
+func bip353Records(accounts map[AccountKey]Account, domain string) ([]Bip353Record, error) {
+	domain = strings.TrimSuffix(domain, ".")
+
+	var records []Bip353Record
+	for accountKey, account := range accounts {
+		if !dnsLabelRegexp.MatchString(string(accountKey)) {
+			return nil, fmt.Errorf("account %s is not a valid DNS label", accountKey)
+		}
+
+		value := bitcoinUriPrefix + "?" + bip353OfferParam + "=" + account.Offer
+		if account.Offer == "" {
+			lnUrl, err := lnurl.LNURLEncode("https://" + domain + "/.well-known/lnurlp/" + string(accountKey))
+			if err != nil {
+				return nil, err
+			}
+			value = bitcoinUriPrefix + "?" + bip353LnUrlParam + "=" + lnUrl
+		}
+
+		records = append(records, Bip353Record{
+			name:  string(accountKey) + "." + bip353Label + "." + domain + ".",
+			value: value,
+		})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].name < records[j].name
+	})
+	return records, nil
+}
+
+func bip353Zone(records []Bip353Record) string {
+	var zone strings.Builder
+	for _, record := range records {
+		zone.WriteString(record.zoneLine() + "\n")
+	}
+	return zone.String()
+}
+
+func verifyBip353Records(records []Bip353Record, lookupTxt func(string) ([]string, error)) []string {
+	var mismatches []string
+	for _, record := range records {
+		values, err := lookupTxt(record.name)
+		if err != nil {
+			mismatches = append(mismatches, record.name+" lookup failed: "+err.Error())
+			continue
+		}
+
+		var bitcoinValues []string
+		for _, value := range values {
+			if strings.HasPrefix(strings.ToLower(value), bitcoinUriPrefix) {
+				bitcoinValues = append(bitcoinValues, value)
+			}
+		}
+
+		switch {
+		case len(bitcoinValues) == 0:
+			mismatches = append(mismatches, record.name+" missing")
+		case len(bitcoinValues) > 1:
+			mismatches = append(mismatches, record.name+" has multiple bitcoin: records")
+		case bitcoinValues[0] != record.value:
+			mismatches = append(mismatches, record.name+" differs: "+bitcoinValues[0])
+		}
+	}
+
+	return mismatches
+}
+
+func isLightningOffer(value string) bool {
+	return strings.HasPrefix(strings.ToLower(value), lightningOfferPrefix)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestBip353Records(t *testing.T) {
+	offer := "lno1" + strings.Repeat("q", 300)
+	accounts := map[AccountKey]Account{
+		"satoshi": {},
+		"hal":     {Offer: offer},
+	}
+
+	records, err := bip353Records(accounts, "nakamoto.example.")
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "hal.user._bitcoin-payment.nakamoto.example.", records[0].name)
+	assert.Equal(t, "bitcoin:?lno="+offer, records[0].value)
+	assert.Equal(t, "satoshi.user._bitcoin-payment.nakamoto.example.", records[1].name)
+	assert.True(t, strings.HasPrefix(records[1].value, "bitcoin:?lnurl=LNURL1"))
+
+	zoneLine := records[0].zoneLine()
+	assert.True(t, strings.HasPrefix(zoneLine, `hal.user._bitcoin-payment.nakamoto.example. 3600 IN TXT "bitcoin:?lno=lno1`))
+	assert.Equal(t, 4, strings.Count(zoneLine, `"`))
+	assert.Equal(t, 2, strings.Count(bip353Zone(records), "\n"))
+
+	_, err = bip353Records(map[AccountKey]Account{"Satoshi_": {}}, "nakamoto.example")
+	assert.Error(t, err)
+}
+
+func TestVerifyBip353Records(t *testing.T) {
+	records := []Bip353Record{
+		{"a.user._bitcoin-payment.nakamoto.example.", "bitcoin:?lno=lno1a"},
+		{"b.user._bitcoin-payment.nakamoto.example.", "bitcoin:?lno=lno1b"},
+		{"c.user._bitcoin-payment.nakamoto.example.", "bitcoin:?lno=lno1c"},
+		{"d.user._bitcoin-payment.nakamoto.example.", "bitcoin:?lno=lno1d"},
+		{"e.user._bitcoin-payment.nakamoto.example.", "bitcoin:?lno=lno1e"},
+	}
+	txtRecords := map[string][]string{
+		records[0].name: {"v=spf1 -all", "bitcoin:?lno=lno1a"},
+		records[1].name: {"bitcoin:?lno=lno1x"},
+		records[2].name: {"bitcoin:?lno=lno1c", "BITCOIN:?lno=lno1c"},
+		records[3].name: {},
+	}
+	lookupTxt := func(name string) ([]string, error) {
+		if values, found := txtRecords[name]; found {
+			return values, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	assert.Equal(t, []string{
+		records[1].name + " differs: bitcoin:?lno=lno1x",
+		records[2].name + " has multiple bitcoin: records",
+		records[3].name + " missing",
+		records[4].name + " lookup failed: no such host",
+	}, verifyBip353Records(records, lookupTxt))
+}
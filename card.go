@@ -0,0 +1,556 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fiatjaf/go-lnurl"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	maxCardResponseSize  = 64 * 1024
+	cardProtocolName     = "create_bolt_card_response"
+	cardProtocolVersion  = 2
+	cardPiccDataTag      = 0xc7
+	cardSpendingInterval = 24 * time.Hour
+)
+
+var (
+	errUnknownCard        = errors.New("unknown card")
+	errInvalidCardTap     = errors.New("invalid card tap")
+	errUnknownCardTap     = errors.New("unknown card tap")
+	errCardDisabled       = errors.New("card disabled")
+	errCardWiped          = errors.New("card wiped")
+	errCardLimitExceeded  = errors.New("card limit exceeded")
+	errInvalidCardInvoice = errors.New("invalid payment request")
+	errInvalidCard        = errors.New("not an LNURL-withdraw card")
+	errCardPaymentFailed  = errors.New("card payment failed")
+	cardSessionVector     = []byte{0x3c, 0xc3, 0x00, 0x01, 0x00, 0x80}
+)
+
+type CardId string
+
+type CardKeys struct {
+	K0 string `json:"k0"`
+	K1 string `json:"k1"`
+	K2 string `json:"k2"`
+	K3 string `json:"k3"`
+	K4 string `json:"k4"`
+}
+
+type Card struct {
+	Id         CardId     `json:"-"`
+	Name       string     `json:"name" binding:"min=1,max=50"`
+	AccountKey AccountKey `json:"accountKey" binding:"required"`
+	TapLimit   int64      `json:"tapLimit" binding:"min=1,max=1000000"`
+	DailyLimit int64      `json:"dailyLimit" binding:"min=1,max=10000000"`
+	Owner      UserKey    `json:"owner"`
+	Created    time.Time  `json:"created"`
+	Keys       CardKeys   `json:"keys"`
+	Uid        string     `json:"uid,omitempty"`
+	Counter    uint32     `json:"counter"`
+	Secret     string     `json:"secret,omitempty"`
+	Enabled    bool       `json:"enabled"`
+	Wiped      bool       `json:"wiped,omitempty"`
+	Spent      int64      `json:"-"`
+}
+
+type CardProgramResponse struct {
+	ProtocolName    string `json:"protocol_name"`
+	ProtocolVersion int    `json:"protocol_version"`
+	CardName        string `json:"card_name"`
+	LnUrlWithdraw   string `json:"lnurlw_base"`
+	CardKeys
+}
+
+type CardWipeRequest struct {
+	Version int    `json:"version"`
+	Action  string `json:"action"`
+	Uid     string `json:"uid,omitempty"`
+	CardKeys
+}
+
+type CardService struct {
+	k1s               *expirable.LRU[string, CardId]
+	repository        *Repository
+	lndClient         *LndClient
+	accountService    *AccountService
+	withdrawalService *WithdrawalService
+	cardMutexes       map[CardId]*sync.Mutex
+	mutex             sync.Mutex
+}
+
+func newCardService(requestExpiry time.Duration, repository *Repository, lndClient *LndClient,
+	accountService *AccountService, withdrawalService *WithdrawalService) *CardService {
+
+	return &CardService{
+		k1s:               expirable.NewLRU[string, CardId](32, nil, requestExpiry),
+		repository:        repository,
+		lndClient:         lndClient,
+		accountService:    accountService,
+		withdrawalService: withdrawalService,
+		cardMutexes:       map[CardId]*sync.Mutex{},
+	}
+}
+
+func (service *CardService) createCard(card *Card) error {
+	keys := make([]string, 5)
+	for i := range keys {
+		key := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		keys[i] = hex.EncodeToString(key)
+	}
+
+	card.Keys = CardKeys{keys[0], keys[1], keys[2], keys[3], keys[4]}
+	card.Uid, card.Counter, card.Secret = "", 0, ""
+	card.Enabled, card.Wiped = true, false
+	card.Created = time.Now()
+	return service.repository.createCard(card)
+}
+
+func (service *CardService) setEnabled(cardId CardId, enabled bool) error {
+	card, unlock := service.lockCard(cardId)
+	if card == nil {
+		return errUnknownCard
+	}
+	defer unlock()
+	if card.Wiped {
+		return errCardWiped
+	}
+
+	card.Enabled = enabled
+	return service.repository.updateCard(card)
+}
+
+func (service *CardService) program(cardId CardId) (*Card, error) {
+	card, unlock := service.lockCard(cardId)
+	if card == nil {
+		return nil, errUnknownCard
+	}
+	defer unlock()
+	if card.Wiped {
+		return nil, errCardWiped
+	}
+
+	card.Secret = lnurl.RandomK1()
+	if err := service.repository.updateCard(card); err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
+
+func (service *CardService) claimKeys(cardId CardId, secret string) (*Card, error) {
+	card, unlock := service.lockCard(cardId)
+	if card == nil {
+		return nil, errUnknownCard
+	}
+	defer unlock()
+
+	if card.Wiped || card.Secret == "" || !hmac.Equal([]byte(secret), []byte(card.Secret)) {
+		return nil, errUnknownCard
+	}
+
+	card.Secret = ""
+	if err := service.repository.updateCard(card); err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
+
+func (service *CardService) wipe(cardId CardId) (*Card, error) {
+	card, unlock := service.lockCard(cardId)
+	if card == nil {
+		return nil, errUnknownCard
+	}
+	defer unlock()
+
+	card.Enabled, card.Wiped, card.Secret = false, true, ""
+	if err := service.repository.updateCard(card); err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
+
+func (service *CardService) tap(cardId CardId, p string, c string) (*Card, string, error) {
+	card, unlock := service.lockCard(cardId)
+	if card == nil {
+		return nil, "", errUnknownCard
+	}
+	defer unlock()
+
+	if !card.Enabled || card.Wiped {
+		return nil, "", errCardDisabled
+	}
+
+	uid, counter, err := decryptCardTap(card.Keys.K1, p)
+	if err != nil {
+		return nil, "", errInvalidCardTap
+	}
+	mac, err := cardTapMac(card.Keys.K2, uid, counter)
+	if err != nil {
+		return nil, "", errInvalidCardTap
+	}
+	if expectedMac, err := hex.DecodeString(c); err != nil || !hmac.Equal(mac, expectedMac) {
+		return nil, "", errInvalidCardTap
+	}
+	if card.Uid != "" && card.Uid != hex.EncodeToString(uid) || counter <= card.Counter {
+		return nil, "", errInvalidCardTap
+	}
+
+	card.Uid, card.Counter = hex.EncodeToString(uid), counter
+	if err := service.repository.updateCard(card); err != nil {
+		return nil, "", err
+	}
+
+	k1 := lnurl.RandomK1()
+	service.k1s.Add(k1, card.Id)
+
+	return card, k1, nil
+}
+
+func (service *CardService) getSpent(card *Card) int64 {
+	var spent int64
+	since := time.Now().Add(-cardSpendingInterval)
+	for _, withdrawal := range service.accountService.getWithdrawals(card.AccountKey) {
+		if withdrawal.Card != card.Id || withdrawal.Canceled || withdrawal.Created.Before(since) {
+			continue
+		}
+		if withdrawal.Withdrawal == nil || !withdrawal.Withdrawal.IsFailed() {
+			spent += withdrawal.Amount - withdrawal.MaxFee
+		}
+	}
+
+	return spent
+}
+
+func (service *CardService) getLimit(card *Card) int64 {
+	return max(min(card.TapLimit, card.DailyLimit-service.getSpent(card)), 0)
+}
+
+func (service *CardService) getWithdrawable(card *Card) int64 {
+	balance := service.accountService.getBalance(card.AccountKey)
+	balance -= withdrawalFee(balance, service.withdrawalService.feePercent)
+
+	return max(min(service.getLimit(card), balance), 0)
+}
+
+func (service *CardService) pay(cardId CardId, k1 string, paymentRequest string) error {
+	withdrawal, request, paymentHash, err := service.createWithdrawal(cardId, k1, paymentRequest)
+	if err != nil {
+		return err
+	}
+
+	err = service.withdrawalService.withdraw(request, paymentRequest, paymentHash)
+	if err != nil && isWithdrawable(service.withdrawalService.getWithdrawal(request.fileName)) {
+		if cancelErr := service.accountService.cancelWithdrawal(request.accountKey, withdrawal); cancelErr != nil {
+			return cancelErr
+		}
+	}
+
+	return err
+}
+
+// createWithdrawal reserves the amount under the card's lock, so that concurrent payments can't exceed its limits;
+// the payment itself is sent once the lock is released.
+func (service *CardService) createWithdrawal(cardId CardId, k1 string,
+	paymentRequest string) (*AccountWithdrawal, *WithdrawalRequest, PaymentHash, error) {
+
+	card, unlock := service.lockCard(cardId)
+	if card == nil {
+		return nil, nil, "", errUnknownCardTap
+	}
+	defer unlock()
+
+	if tapCardId, k1Valid := service.k1s.Get(k1); !k1Valid || tapCardId != cardId {
+		return nil, nil, "", errUnknownCardTap
+	}
+	service.k1s.Remove(k1)
+
+	if !card.Enabled || card.Wiped {
+		return nil, nil, "", errCardDisabled
+	}
+
+	paymentHash, amount := service.lndClient.decodePaymentRequest(paymentRequest)
+	if paymentHash == "" || amount < 1 {
+		return nil, nil, "", errInvalidCardInvoice
+	}
+	if amount > service.getLimit(card) {
+		return nil, nil, "", errCardLimitExceeded
+	}
+
+	fee := withdrawalFee(amount, service.withdrawalService.feePercent)
+	withdrawal := AccountWithdrawal{Owner: card.Owner, Amount: amount + fee, MaxFee: fee, Card: card.Id, Approver: card.Owner}
+	if err := service.accountService.createWithdrawal(card.AccountKey, &withdrawal); err != nil {
+		return nil, nil, "", err
+	}
+
+	request := WithdrawalRequest{
+		fileName:    service.repository.getAccountWithdrawalFileName(card.AccountKey, &withdrawal),
+		amount:      amount,
+		feeLimit:    fee,
+		description: card.Name,
+		accountKey:  card.AccountKey,
+	}
+
+	return &withdrawal, &request, paymentHash, nil
+}
+
+// lockCard returns the card locked against concurrent updates of the same card only.
+func (service *CardService) lockCard(cardId CardId) (*Card, func()) {
+	service.mutex.Lock()
+	mutex, exists := service.cardMutexes[cardId]
+	if !exists {
+		if service.repository.getCard(cardId) == nil {
+			service.mutex.Unlock()
+			return nil, nil
+		}
+		mutex = &sync.Mutex{}
+		service.cardMutexes[cardId] = mutex
+	}
+	service.mutex.Unlock()
+
+	mutex.Lock()
+	card := service.repository.getCard(cardId)
+	if card == nil {
+		mutex.Unlock()
+		return nil, nil
+	}
+
+	return card, mutex.Unlock
+}
+
+func sortCards(cards []*Card) []*Card {
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].Created.After(cards[j].Created)
+	})
+	return cards
+}
+
+func decryptCardTap(key string, p string) ([]byte, uint32, error) {
+	block, err := newCardCipher(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	piccData, err := hex.DecodeString(p)
+	if err != nil || len(piccData) != aes.BlockSize {
+		return nil, 0, errInvalidCardTap
+	}
+
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(piccData, piccData)
+	if piccData[0] != cardPiccDataTag {
+		return nil, 0, errInvalidCardTap
+	}
+	counter := uint32(piccData[8]) | uint32(piccData[9])<<8 | uint32(piccData[10])<<16
+
+	return piccData[1:8], counter, nil
+}
+
+func cardTapMac(key string, uid []byte, counter uint32) ([]byte, error) {
+	block, err := newCardCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionVector := append(append([]byte{}, cardSessionVector...), uid...)
+	sessionVector = append(sessionVector, byte(counter), byte(counter>>8), byte(counter>>16))
+	sessionBlock, err := aes.NewCipher(aesCmac(block, sessionVector))
+	if err != nil {
+		return nil, err
+	}
+
+	fullMac := aesCmac(sessionBlock, nil)
+	mac := make([]byte, 0, aes.BlockSize/2)
+	for i := 1; i < len(fullMac); i += 2 {
+		mac = append(mac, fullMac[i])
+	}
+
+	return mac, nil
+}
+
+func newCardCipher(key string) (cipher.Block, error) {
+	keyBytes, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	return aes.NewCipher(keyBytes)
+}
+
+func aesCmac(block cipher.Block, message []byte) []byte {
+	subkey1 := cmacSubkey(block, make([]byte, aes.BlockSize))
+	subkey2 := cmacSubkey(nil, subkey1)
+
+	blocksCount := max((len(message)+aes.BlockSize-1)/aes.BlockSize, 1)
+	lastBlock := make([]byte, aes.BlockSize)
+	lastBlockStart := (blocksCount - 1) * aes.BlockSize
+	if len(message) > 0 && len(message)%aes.BlockSize == 0 {
+		xorBlock(lastBlock, message[lastBlockStart:], subkey1)
+	} else {
+		copy(lastBlock, message[lastBlockStart:])
+		lastBlock[len(message)-lastBlockStart] = 0x80
+		xorBlock(lastBlock, lastBlock, subkey2)
+	}
+
+	mac := make([]byte, aes.BlockSize)
+	for i := 0; i < blocksCount-1; i++ {
+		xorBlock(mac, mac, message[i*aes.BlockSize:])
+		block.Encrypt(mac, mac)
+	}
+	xorBlock(mac, mac, lastBlock)
+	block.Encrypt(mac, mac)
+
+	return mac
+}
+
+func cmacSubkey(block cipher.Block, input []byte) []byte {
+	if block != nil {
+		block.Encrypt(input, input)
+	}
+
+	subkey := make([]byte, aes.BlockSize)
+	for i := range subkey {
+		subkey[i] = input[i] << 1
+		if i+1 < len(input) {
+			subkey[i] |= input[i+1] >> 7
+		}
+	}
+	if input[0]&0x80 != 0 {
+		subkey[aes.BlockSize-1] ^= 0x87
+	}
+
+	return subkey
+}
+
+func xorBlock(destination []byte, a []byte, b []byte) {
+	for i := range destination {
+		destination[i] = a[i] ^ b[i]
+	}
+}
+
+// cardHttpClient only connects to public hosts, as card URLs are entered by terminal users.
+var cardHttpClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublicAddress}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		if request.URL.Scheme != "https" || len(via) >= 3 {
+			return errInvalidCard
+		}
+		return nil
+	},
+}
+
+func dialPublicAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIp(ip) {
+		return fmt.Errorf("non-public address: %s", host)
+	}
+	return nil
+}
+
+func isPublicIp(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+func parseCardUrl(card string) (*url.URL, error) {
+	rawUrl := card
+	if strings.HasPrefix(card, "lnurlw://") {
+		rawUrl = "https://" + strings.TrimPrefix(card, "lnurlw://")
+	} else if !strings.HasPrefix(card, "https://") {
+		lnUrl, ok := lnurl.FindLNURLInText(card)
+		if !ok {
+			return nil, errInvalidCard
+		}
+		decodedUrl, err := lnurl.LNURLDecode(lnUrl)
+		if err != nil {
+			return nil, errInvalidCard
+		}
+		rawUrl = decodedUrl
+	}
+
+	cardUrl, err := url.Parse(rawUrl)
+	if err != nil || cardUrl.Scheme != "https" || cardUrl.Hostname() == "" {
+		return nil, errInvalidCard
+	}
+	return cardUrl, nil
+}
+
+func getCardResponse(cardUrl *url.URL, response any) error {
+	httpResponse, err := cardHttpClient.Get(cardUrl.String())
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(io.LimitReader(httpResponse.Body, maxCardResponseSize))
+	if err := json.Unmarshal(bodyBytes, response); err != nil {
+		return fmt.Errorf("invalid card response: %w", err)
+	}
+	return nil
+}
+
+// payWithCard reports card failures with generic errors only; remote details are just logged.
+func payWithCard(card string, invoice *Invoice) error {
+	cardUrl, err := parseCardUrl(card)
+	if err != nil {
+		return err
+	}
+
+	var withdrawParams lnurl.LNURLWithdrawResponse
+	if err := getCardResponse(cardUrl, &withdrawParams); err != nil {
+		log.Println("error reading card:", err)
+		return errCardPaymentFailed
+	}
+	if withdrawParams.Tag != withdrawRequestTag {
+		return errInvalidCard
+	}
+	if msats(invoice.amount) < withdrawParams.MinWithdrawable || msats(invoice.amount) > withdrawParams.MaxWithdrawable {
+		return fmt.Errorf("amount not withdrawable: %d", invoice.amount)
+	}
+
+	callbackUrl, err := url.Parse(withdrawParams.Callback)
+	if err != nil || callbackUrl.Scheme != "https" || callbackUrl.Hostname() == "" {
+		return errInvalidCard
+	}
+	query := callbackUrl.Query()
+	query.Set(k1Param, withdrawParams.K1)
+	query.Set(prParam, invoice.paymentRequest)
+	callbackUrl.RawQuery = query.Encode()
+
+	var callbackResponse lnurl.LNURLResponse
+	if err := getCardResponse(callbackUrl, &callbackResponse); err != nil {
+		log.Println("error paying with card:", err)
+		return errCardPaymentFailed
+	}
+	if callbackResponse.Status != "OK" {
+		log.Println("card payment declined:", callbackResponse.Reason)
+		return errCardPaymentFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/fiatjaf/go-lnurl"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPayWithCard(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var response any
+		switch {
+		case request.URL.Path == "/card":
+			response = lnurl.LNURLWithdrawResponse{
+				Tag:             withdrawRequestTag,
+				K1:              "e2af6254a8df433264fa23f67eb8188635d15ce883e8fc020989d5f82ae6f11e",
+				Callback:        server.URL + "/callback?card=1",
+				MinWithdrawable: 1_000,
+				MaxWithdrawable: 21_000_000,
+			}
+		case request.URL.Path == "/insecure":
+			response = lnurl.LNURLWithdrawResponse{
+				Tag:             withdrawRequestTag,
+				Callback:        strings.Replace(server.URL, "https:", "http:", 1) + "/callback",
+				MaxWithdrawable: 21_000_000,
+			}
+		case request.URL.Query().Get(k1Param) != "e2af6254a8df433264fa23f67eb8188635d15ce883e8fc020989d5f82ae6f11e":
+			response = lnurl.ErrorResponse("invalid k1")
+		case request.URL.Query().Get("card") != "1" || request.URL.Query().Get(prParam) != "lnbc210u1...":
+			response = lnurl.ErrorResponse("invalid invoice")
+		default:
+			response = lnurl.OkResponse()
+		}
+		_ = json.NewEncoder(writer).Encode(response)
+	}))
+	defer server.Close()
+
+	t.Run("publicHostsOnly", func(t *testing.T) {
+		assert.ErrorIs(t, payWithCard(server.URL+"/card", &Invoice{amount: 21_000}), errCardPaymentFailed)
+		assert.ErrorIs(t, payWithCard("lnurlw://127.0.0.1/card", &Invoice{amount: 21_000}), errCardPaymentFailed)
+	})
+
+	defaultClient := cardHttpClient
+	cardHttpClient = server.Client()
+	defer func() { cardHttpClient = defaultClient }()
+
+	assert.NoError(t, payWithCard(server.URL+"/card", &Invoice{paymentRequest: "lnbc210u1...", amount: 21_000}))
+	assert.ErrorIs(t, payWithCard(server.URL+"/card", &Invoice{paymentRequest: "lnbc1...", amount: 21_000}), errCardPaymentFailed)
+	assert.EqualError(t, payWithCard(server.URL+"/card", &Invoice{amount: 21_001}), "amount not withdrawable: 21001")
+	assert.ErrorIs(t, payWithCard(server.URL+"/insecure", &Invoice{amount: 21_000}), errInvalidCard)
+	assert.ErrorIs(t, payWithCard(strings.Replace(server.URL, "https:", "http:", 1)+"/card", &Invoice{amount: 21}), errInvalidCard)
+	assert.ErrorIs(t, payWithCard("coffee", &Invoice{amount: 21}), errInvalidCard)
+}
+
+func TestIsPublicIp(t *testing.T) {
+	for ip, expected := range map[string]bool{
+		"1.1.1.1":              true,
+		"2606:4700:4700::1111": true,
+		"127.0.0.1":            false,
+		"10.0.0.1":             false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"0.0.0.0":              false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+	} {
+		assert.Equal(t, expected, isPublicIp(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestAesCmac(t *testing.T) {
+	block, _ := newCardCipher("2b7e151628aed2a6abf7158809cf4f3c")
+	message, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411" +
+		"e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+
+	assert.Equal(t, "bb1d6929e95937287fa37d129b756746", hex.EncodeToString(aesCmac(block, nil)))
+	assert.Equal(t, "070a16b46b4d4144f79bdd9dd04a287c", hex.EncodeToString(aesCmac(block, message[:16])))
+	assert.Equal(t, "dfa66747de9ae63030ca32611497c827", hex.EncodeToString(aesCmac(block, message[:40])))
+	assert.Equal(t, "51f0bebf7e3b9d92fc49741779363cfe", hex.EncodeToString(aesCmac(block, message)))
+}
+
+func TestCardTap(t *testing.T) {
+	const k1, k2 = "0c3b25d92b38ae443229dd59ad34b85d", "b45775776cb224c75bcde7ca3704e933"
+	for p, c := range map[string]string{
+		"4E2E289D945A66BB13377A728884E867": "E19CCB1FED8892CE",
+		"00F48C4F8E386DED06BCDC78FA92E2FE": "66B4826EA4C155B4",
+		"0DBF3C59B59B0638D60B5842A997D4D1": "CC61660C020B4D96",
+	} {
+		uid, counter, err := decryptCardTap(k1, p)
+		assert.NoError(t, err)
+		assert.Equal(t, "04996c6a926980", hex.EncodeToString(uid))
+		mac, err := cardTapMac(k2, uid, counter)
+		assert.NoError(t, err)
+		assert.Equal(t, c, strings.ToUpper(hex.EncodeToString(mac)), "counter %d", counter)
+	}
+}
+
+func TestCardService(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	withdrawalService := newWithdrawalService(WithdrawalConfig{FeePercent: 1, RequestExpiry: 1 * time.Minute}, repository, nil)
+	accountService := newAccountService(nil, repository, nil, withdrawalService, newOnChainService(repository, nil))
+	service := newCardService(1*time.Minute, repository, nil, accountService, withdrawalService)
+
+	card := Card{Name: "Satoshi", AccountKey: "shop", TapLimit: 5_000, DailyLimit: 8_000, Owner: "admin"}
+	assert.NoError(t, service.createCard(&card))
+	assert.Regexp(t, "^[0-9a-f]{32}$", card.Keys.K4)
+	assert.True(t, card.Enabled)
+	assert.Equal(t, card.Keys, repository.getCard(card.Id).Keys)
+
+	tap := func(uid string, counter uint32) (string, string) {
+		block, _ := newCardCipher(card.Keys.K1)
+		uidBytes, _ := hex.DecodeString(uid)
+		piccData := append(append([]byte{cardPiccDataTag}, uidBytes...), byte(counter), byte(counter>>8), byte(counter>>16))
+		piccData = append(piccData, make([]byte, 5)...)
+		cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(piccData, piccData)
+		mac, _ := cardTapMac(card.Keys.K2, uidBytes, counter)
+		return hex.EncodeToString(piccData), hex.EncodeToString(mac)
+	}
+
+	p, c := tap("04996c6a926980", 1)
+	tappedCard, k1, err := service.tap(card.Id, p, c)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^[0-9a-f]{64}$", k1)
+	assert.Equal(t, "04996c6a926980", tappedCard.Uid)
+	assert.Equal(t, uint32(1), repository.getCard(card.Id).Counter)
+	_, _, err = service.tap(card.Id, p, c)
+	assert.ErrorIs(t, err, errInvalidCardTap)
+	_, _, err = service.tap(card.Id, p, "0000000000000000")
+	assert.ErrorIs(t, err, errInvalidCardTap)
+	p, c = tap("04996c6a926981", 2)
+	_, _, err = service.tap(card.Id, p, c)
+	assert.ErrorIs(t, err, errInvalidCardTap)
+	assert.ErrorIs(t, service.pay(card.Id, "invalid", "lnbc1..."), errUnknownCardTap)
+
+	assert.NoError(t, repository.createAccountLedger("bakery", &AccountLedger{}))
+	assert.NoError(t, repository.addAccountLedgerEntry("bakery", LedgerEntry{amount: 10_000, account: "shop"}))
+	assert.Equal(t, int64(5_000), service.getWithdrawable(&card))
+	spent := AccountWithdrawal{Amount: 4_040, MaxFee: 40, Card: card.Id, Created: time.Now()}
+	assert.NoError(t, repository.createAccountWithdrawal("shop", &spent))
+	assert.Equal(t, int64(4_000), service.getSpent(&card))
+	assert.Equal(t, int64(4_000), service.getWithdrawable(&card))
+	assert.NoError(t, repository.createAccountWithdrawal("shop", &AccountWithdrawal{Amount: 5_000}))
+	assert.Equal(t, int64(4_000), service.getLimit(&card))
+	assert.Equal(t, int64(951), service.getWithdrawable(&card))
+	assert.ErrorIs(t, service.pay("invalid", k1, "lnbc1..."), errUnknownCardTap)
+
+	assert.NoError(t, service.setEnabled(card.Id, false))
+	p, c = tap("04996c6a926980", 3)
+	_, _, err = service.tap(card.Id, p, c)
+	assert.ErrorIs(t, err, errCardDisabled)
+	_, _, err = service.tap("invalid", p, c)
+	assert.ErrorIs(t, err, errUnknownCard)
+	assert.Len(t, repository.getCards(), 1)
+
+	programmedCard, err := service.program(card.Id)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^[0-9a-f]{64}$", programmedCard.Secret)
+	_, err = service.claimKeys(card.Id, "invalid")
+	assert.ErrorIs(t, err, errUnknownCard)
+	claimedCard, err := service.claimKeys(card.Id, programmedCard.Secret)
+	assert.NoError(t, err)
+	assert.Equal(t, card.Keys, claimedCard.Keys)
+	_, err = service.claimKeys(card.Id, programmedCard.Secret)
+	assert.ErrorIs(t, err, errUnknownCard)
+
+	wipedCard, err := service.wipe(card.Id)
+	assert.NoError(t, err)
+	assert.True(t, wipedCard.Wiped)
+	assert.False(t, repository.getCard(card.Id).Enabled)
+	assert.ErrorIs(t, service.setEnabled(card.Id, true), errCardWiped)
+	_, err = service.program(card.Id)
+	assert.ErrorIs(t, err, errCardWiped)
+	assert.ErrorIs(t, service.setEnabled("invalid", true), errUnknownCard)
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"crypto/rand"
+	"fmt"
+	"github.com/nbd-wtf/go-nostr"
 	"gopkg.in/yaml.v3"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"slices"
 	"strings"
@@ -19,10 +23,13 @@ type Config struct {
 	Credentials    map[UserKey]string
 	Administrators []UserKey
 	AccessControl  map[UserKey][]AccountKey `yaml:"access-control"`
-	Thumbnails     map[UserKey]string       `yaml:"thumbnails"`
+	Operators      map[UserKey]OperatorConfig
+	Thumbnails     map[UserKey]string `yaml:"thumbnails"`
 	Accounts       map[AccountKey]Account
 	Authentication AuthenticationConfig
 	Withdrawal     WithdrawalConfig
+	LnUrlEncoding  LnUrlEncodingConfig `yaml:"lnurl-encoding"`
+	TrustedProxies []string            `yaml:"trusted-proxies"`
 }
 
 func (config *Config) cookieKey() []byte {
@@ -48,16 +55,81 @@ type UserKey string
 type AccountKey string
 
 type Account struct {
-	Currency       Currency `yaml:"currency"`
-	MinSendable    uint32   `yaml:"min-sendable"`
-	MaxSendable    uint32   `yaml:"max-sendable"`
-	Description    string
-	Thumbnail      string
-	IsAlsoEmail    bool   `yaml:"is-also-email"`
-	CommentAllowed uint16 `yaml:"comment-allowed"`
-	AllowsNostr    bool   `yaml:"allows-nostr"`
-	SuccessMessage string `yaml:"success-message"`
-	Archivable     bool
+	Currency        Currency `yaml:"currency"`
+	MinSendable     uint32   `yaml:"min-sendable"`
+	MaxSendable     uint32   `yaml:"max-sendable"`
+	Description     string
+	Thumbnail       string
+	Thumbnails      []string
+	LongDescription string         `yaml:"long-description"`
+	IdentifierType  IdentifierType `yaml:"identifier-type"`
+	IsAlsoEmail     bool           `yaml:"is-also-email"`
+	CommentAllowed  uint16         `yaml:"comment-allowed"`
+	AllowsNostr     bool           `yaml:"allows-nostr"`
+	NostrPubkey     string         `yaml:"nostr-pubkey"`
+	NostrRelays     []string       `yaml:"nostr-relays"`
+	Offer           string
+	OnChain         AccountOnChainConfig `yaml:"on-chain"`
+	SuccessMessage  string               `yaml:"success-message"`
+	SuccessUrl      string               `yaml:"success-url"`
+	SuccessSecret   string               `yaml:"success-secret"`
+	Archivable      bool
+	Refundable      bool
+	Tips            []TipPreset
+	Terminal        AccountTerminalConfig
+	Receipt         AccountReceiptConfig
+	Withdrawal      AccountWithdrawalConfig
+	Forwarding      AccountForwardingConfig
+	Splits          []AccountSplit
+	PayerData       AccountPayerDataConfig `yaml:"payer-data"`
+}
+
+type AccountTerminalConfig struct {
+	Currencies []Currency
+}
+
+type AccountWithdrawalConfig struct {
+	MinAmount        uint32 `yaml:"min-amount"`
+	MaxAmount        uint32 `yaml:"max-amount"`
+	RequiresApproval bool   `yaml:"requires-approval"`
+}
+
+func (config *AccountWithdrawalConfig) isEnabled() bool {
+	return config.MaxAmount > 0
+}
+
+type AccountForwardingConfig struct {
+	Target    string
+	Threshold uint32
+	Interval  time.Duration
+	MaxFee    uint32 `yaml:"max-fee"`
+}
+
+func (config *AccountForwardingConfig) isEnabled() bool {
+	return config.Target != ""
+}
+
+func (config *AccountForwardingConfig) getInterval() time.Duration {
+	if interval := config.Interval; interval != 0 {
+		return interval
+	}
+	return 1 * time.Hour
+}
+
+func (account *Account) hasExternalSplits() bool {
+	return slices.ContainsFunc(account.Splits, func(split AccountSplit) bool {
+		return split.isExternal()
+	})
+}
+
+func (account *Account) getIdentifierType() IdentifierType {
+	if account.IdentifierType != "" {
+		return account.IdentifierType
+	}
+	if account.IsAlsoEmail {
+		return IdentifierTypeEmail
+	}
+	return IdentifierTypeIdentifier
 }
 
 func (account *Account) getCurrency() Currency {
@@ -81,9 +153,10 @@ func msats[T int | uint32 | int64](sats T) int64 {
 
 func loadConfig(configFileName string) *Config {
 	config := Config{
-		Listen:       "127.0.0.1:8088",
-		ThumbnailDir: "/etc/lnurld/thumbnails",
-		DataDir:      "/var/lib/lnurld",
+		Listen:         "127.0.0.1:8088",
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+		ThumbnailDir:   "/etc/lnurld/thumbnails",
+		DataDir:        "/var/lib/lnurld",
 		Lnd: LndConfig{
 			Address:      "127.0.0.1:10009",
 			CertFile:     "/var/lib/lnd/tls.cert",
@@ -115,8 +188,12 @@ func loadConfig(configFileName string) *Config {
 
 	validateAdministrators(&config)
 	validateAccessControl(&config)
+	validateOperators(&config)
 	validateThumbnails(&config)
 	validateAccounts(&config)
+	if !config.LnUrlEncoding.isValid() {
+		log.Fatal("Invalid config value lnurl-encoding: ", config.LnUrlEncoding)
+	}
 
 	return &config
 }
@@ -142,6 +219,25 @@ func validateAccessControl(config *Config) {
 	}
 }
 
+func validateOperators(config *Config) {
+	for operator, operatorConfig := range config.Operators {
+		if _, userExists := config.Credentials[operator]; userExists || operator == "" {
+			log.Fatal("Invalid operator in property operators: ", operator)
+		}
+		if !pinRegexp.MatchString(operatorConfig.Pin) {
+			log.Fatal("Invalid PIN in property operators.", operator)
+		}
+		if len(operatorConfig.Accounts) == 0 {
+			log.Fatal("No accounts in property operators.", operator)
+		}
+		for _, accountKey := range operatorConfig.Accounts {
+			if _, accountExists := config.Accounts[accountKey]; !accountExists {
+				log.Fatal("Unknown account in property operators.", operator, ".accounts: ", accountKey)
+			}
+		}
+	}
+}
+
 func validateThumbnails(config *Config) {
 	for user, _ := range config.Thumbnails {
 		if _, userExists := config.Credentials[user]; !userExists {
@@ -164,12 +260,106 @@ func validateAccounts(config *Config) {
 		if strings.TrimSpace(account.Description) == "" {
 			logInvalidAccountValue(accountKey, "description", account.Description)
 		}
+		if !account.IdentifierType.isValid() || account.IsAlsoEmail && account.getIdentifierType() != IdentifierTypeEmail {
+			logInvalidAccountValue(accountKey, "identifier-type", account.IdentifierType)
+		}
+		var thumbnails []*Thumbnail
+		for _, fileName := range append([]string{account.Thumbnail}, account.Thumbnails...) {
+			if fileName == "" {
+				continue
+			}
+			thumbnail, err := readThumbnail(config.ThumbnailDir + fileName)
+			if err != nil {
+				log.Println("error reading thumbnail:", err) // not fatal, served without it
+				continue
+			}
+			thumbnails = append(thumbnails, thumbnail)
+		}
+		metadata := newAccountMetadata(accountKey, &account, strings.Repeat("x", maxHostLength), thumbnails, true)
+		if err := metadata.validate(); err != nil {
+			log.Println("error validating metadata:", err)
+			logInvalidAccountValue(accountKey, "metadata", len(metadata.Encode()))
+		}
+		if _, err := parseNostrPublicKey(account.NostrPubkey); account.NostrPubkey != "" && err != nil {
+			logInvalidAccountValue(accountKey, "nostr-pubkey", account.NostrPubkey)
+		}
+		for i, relay := range account.NostrRelays {
+			if account.NostrPubkey == "" || !nostr.IsValidRelayURL(relay) {
+				logInvalidAccountValue(accountKey, fmt.Sprintf("nostr-relays[%d]", i), relay)
+			}
+		}
+		if account.Offer != "" && !isLightningOffer(account.Offer) {
+			logInvalidAccountValue(accountKey, "offer", account.Offer)
+		}
 		if account.CommentAllowed > 2000 {
 			logInvalidAccountValue(accountKey, "comment-allowed", account.CommentAllowed)
 		}
 		if len(account.SuccessMessage) > 144 {
 			logInvalidAccountValue(accountKey, "success-message", account.SuccessMessage)
 		}
+		if successUrl, err := url.Parse(account.SuccessUrl); account.SuccessUrl != "" &&
+			(err != nil || successUrl.Scheme != "https" && successUrl.Scheme != "http" || successUrl.Host == "") {
+			logInvalidAccountValue(accountKey, "success-url", account.SuccessUrl)
+		}
+		if len(account.SuccessSecret) > 4096 || account.SuccessSecret != "" && account.SuccessUrl != "" {
+			logInvalidAccountValue(accountKey, "success-secret", account.SuccessSecret)
+		}
+		if withdrawal := account.Withdrawal; withdrawal.MinAmount > withdrawal.MaxAmount {
+			logInvalidAccountValue(accountKey, "withdrawal.min-amount", withdrawal.MinAmount)
+		}
+		for i, tip := range account.Tips {
+			if !tip.isValid() || slices.Contains(account.Tips[:i], tip) {
+				logInvalidAccountValue(accountKey, fmt.Sprintf("tips[%d]", i), tip)
+			}
+		}
+		for i, currency := range account.Terminal.Currencies {
+			if !slices.Contains(supportedCurrencies(), currency) && currency != SAT ||
+				currency == account.getCurrency() || slices.Contains(account.Terminal.Currencies[:i], currency) {
+				logInvalidAccountValue(accountKey, fmt.Sprintf("terminal.currencies[%d]", i), currency)
+			}
+		}
+		if receipt := account.Receipt; receipt.Printer != "" {
+			if _, _, err := net.SplitHostPort(receipt.Printer); err != nil {
+				logInvalidAccountValue(accountKey, "receipt.printer", receipt.Printer)
+			}
+		}
+		if columns := account.Receipt.Columns; columns != 0 && (columns < 24 || columns > 80) {
+			logInvalidAccountValue(accountKey, "receipt.columns", columns)
+		}
+		if !account.PayerData.isValid() {
+			logInvalidAccountValue(accountKey, "payer-data", account.PayerData)
+		}
+		var splitsPercent float32
+		for i, split := range account.Splits {
+			property := fmt.Sprintf("splits[%d]", i)
+			if (split.Account == "") == (split.Target == "") {
+				logInvalidAccountValue(accountKey, property, "exactly one of account and target required")
+			}
+			if _, accountExists := config.Accounts[split.Account]; split.Account == accountKey || split.Account != "" && !accountExists {
+				logInvalidAccountValue(accountKey, property+".account", split.Account)
+			}
+			if split.isExternal() && !isLnUrlPayTarget(split.Target) {
+				logInvalidAccountValue(accountKey, property+".target", split.Target)
+			}
+			if split.Percent <= 0 || split.Percent > 100 {
+				logInvalidAccountValue(accountKey, property+".percent", split.Percent)
+			}
+			splitsPercent += split.Percent
+		}
+		if splitsPercent > 100 {
+			logInvalidAccountValue(accountKey, "splits", splitsPercent)
+		}
+		if forwarding := account.Forwarding; forwarding.isEnabled() {
+			if !isLnUrlPayTarget(forwarding.Target) {
+				logInvalidAccountValue(accountKey, "forwarding.target", forwarding.Target)
+			}
+			if forwarding.Threshold <= forwarding.MaxFee {
+				logInvalidAccountValue(accountKey, "forwarding.threshold", forwarding.Threshold)
+			}
+			if interval := forwarding.getInterval(); interval < 1*time.Minute || interval > 24*time.Hour {
+				logInvalidAccountValue(accountKey, "forwarding.interval", forwarding.Interval)
+			}
+		}
 	}
 }
 
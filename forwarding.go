@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fiatjaf/go-lnurl"
+	"log"
+	"time"
+)
+
+type ForwardingService struct {
+	repository        *Repository
+	lndClient         *LndClient
+	accountService    *AccountService
+	withdrawalService *WithdrawalService
+}
+
+func newForwardingService(accounts map[AccountKey]Account, repository *Repository, lndClient *LndClient,
+	accountService *AccountService, withdrawalService *WithdrawalService) *ForwardingService {
+
+	service := ForwardingService{
+		repository:        repository,
+		lndClient:         lndClient,
+		accountService:    accountService,
+		withdrawalService: withdrawalService,
+	}
+
+	for accountKey, account := range accounts {
+		if forwarding := account.Forwarding; forwarding.isEnabled() || account.hasExternalSplits() {
+			go func(accountKey AccountKey) {
+				for true {
+					service.forward(accountKey, forwarding)
+					time.Sleep(forwarding.getInterval())
+				}
+			}(accountKey)
+		}
+	}
+
+	return &service
+}
+
+func (service *ForwardingService) forward(accountKey AccountKey, config AccountForwardingConfig) {
+	var outstanding bool
+	for _, withdrawal := range service.accountService.getWithdrawals(accountKey) {
+		if !withdrawal.IsForward() || !withdrawal.isOutstanding() {
+			continue
+		}
+		outstanding = outstanding || !withdrawal.Split
+		if !withdrawal.isInProgress() {
+			service.pay(accountKey, withdrawal)
+		}
+	}
+	if !config.isEnabled() || outstanding {
+		return
+	}
+
+	balance := service.accountService.getBalance(accountKey)
+	if balance < int64(config.Threshold) {
+		return
+	}
+
+	withdrawal := AccountWithdrawal{Target: config.Target, Amount: balance, MaxFee: int64(config.MaxFee)}
+	if err := service.accountService.createWithdrawal(accountKey, &withdrawal); err != nil {
+		log.Println("error creating forward:", err)
+		return
+	}
+
+	service.pay(accountKey, &withdrawal)
+}
+
+func (service *ForwardingService) pay(accountKey AccountKey, withdrawal *AccountWithdrawal) {
+	amount := withdrawal.Amount - withdrawal.MaxFee
+	log.Printf("forwarding %d sats from %s to %s", amount, accountKey, withdrawal.Target)
+
+	if err := service.sendPayment(accountKey, withdrawal, amount, withdrawal.MaxFee); err != nil {
+		log.Printf("error forwarding %d sats from %s to %s: %v", amount, accountKey, withdrawal.Target, err)
+	}
+}
+
+func (service *ForwardingService) sendPayment(accountKey AccountKey, withdrawal *AccountWithdrawal, amount int64, feeLimit int64) error {
+	_, params, err := lnurl.HandleLNURL(withdrawal.Target)
+	if err != nil {
+		return err
+	}
+	payParams, isPayParams := params.(lnurl.LNURLPayParams)
+	if !isPayParams {
+		return errors.New("not an LNURL-pay target")
+	}
+	if msats(amount) < payParams.MinSendable || msats(amount) > payParams.MaxSendable {
+		return fmt.Errorf("amount not sendable: %d", amount)
+	}
+
+	payValues, err := payParams.Call(msats(amount), "", nil)
+	if err != nil {
+		return err
+	}
+
+	paymentHash, invoiceAmount := service.lndClient.decodePaymentRequest(payValues.PR)
+	if paymentHash == "" || invoiceAmount != amount {
+		return errors.New("invalid payment request")
+	}
+
+	request := WithdrawalRequest{
+		fileName:    service.repository.getAccountWithdrawalFileName(accountKey, withdrawal),
+		amount:      amount,
+		feeLimit:    feeLimit,
+		description: withdrawal.Target,
+		accountKey:  accountKey,
+	}
+
+	return service.withdrawalService.withdraw(&request, payValues.PR, paymentHash)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestForwardingService(t *testing.T) {
+	var requestsCount int
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestsCount++
+		_, _ = writer.Write([]byte(`{"status":"ERROR","reason":"Unknown account"}`))
+	}))
+	defer server.Close()
+
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	withdrawalService := newWithdrawalService(
+		WithdrawalConfig{FeePercent: 0, RequestExpiry: 1 * time.Minute}, repository, nil,
+	)
+	accountService := newAccountService(nil, repository, nil, withdrawalService, newOnChainService(repository, nil))
+	service := newForwardingService(nil, repository, nil, accountService, withdrawalService)
+	config := AccountForwardingConfig{Target: server.URL, Threshold: 1_000, MaxFee: 10}
+
+	service.forward("cafe", config)
+	assert.Equal(t, 0, requestsCount)
+	assert.Empty(t, accountService.getWithdrawals("cafe"))
+
+	forward := AccountWithdrawal{Target: server.URL, Amount: 2_100, Created: time.Now()}
+	assert.NoError(t, repository.createAccountWithdrawal("cafe", &forward))
+	assert.True(t, forward.IsForward())
+	assert.True(t, forward.IsApproved())
+	assert.False(t, forward.IsWithdrawable())
+
+	service.forward("cafe", config)
+	assert.Equal(t, 1, requestsCount)
+	assert.Len(t, accountService.getWithdrawals("cafe"), 1)
+
+	assert.NoError(t, accountService.cancelWithdrawal("cafe", &forward))
+	service.forward("cafe", config)
+	assert.Equal(t, 1, requestsCount)
+	assert.Len(t, accountService.getWithdrawals("cafe"), 1)
+}
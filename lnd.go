@@ -2,19 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"github.com/hashicorp/golang-lru/v2"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/lightningnetwork/lnd/macaroons"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 	"gopkg.in/macaroon.v2"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
-const invoiceExpiryInSeconds = 300
+const (
+	invoiceExpiryInSeconds = 300
+	paymentTimeoutSeconds  = 60
+)
+
+var errPaymentNotFound = errors.New("payment not found")
 
 type LndConfig struct {
 	Address      string
@@ -53,10 +64,42 @@ func (invoice *Invoice) isSettled() bool {
 	return !invoice.settleDate.IsZero()
 }
 
+func (invoice *Invoice) preimageBytes() ([]byte, error) {
+	preimage, err := hex.DecodeString(invoice.preimage)
+	if err != nil || len(preimage) != 32 {
+		return nil, errors.New("invalid preimage")
+	}
+	return preimage, nil
+}
+
+type OnChainReceipt struct {
+	amount        int64
+	confirmations int32
+	timestamp     time.Time
+}
+
+type PaymentStatus string
+
+const (
+	PaymentInFlight  PaymentStatus = "in-flight"
+	PaymentSucceeded PaymentStatus = "succeeded"
+	PaymentFailed    PaymentStatus = "failed"
+)
+
+type Payment struct {
+	paymentHash   PaymentHash
+	status        PaymentStatus
+	fee           int64
+	failureReason string
+}
+
+type PaymentStream func() (*Payment, error)
+
 type LndClient struct {
-	lnClient lnrpc.LightningClient
-	ctx      context.Context
-	invoices *lru.Cache[PaymentHash, Invoice]
+	lnClient     lnrpc.LightningClient
+	routerClient routerrpc.RouterClient
+	ctx          context.Context
+	invoices     *lru.Cache[PaymentHash, Invoice]
 }
 
 func newLndClient(config LndConfig) *LndClient {
@@ -99,15 +142,22 @@ func newLndClient(config LndConfig) *LndClient {
 	}
 
 	return &LndClient{
-		lnClient: lnrpc.NewLightningClient(connection),
-		ctx:      context.Background(),
-		invoices: invoices,
+		lnClient:     lnrpc.NewLightningClient(connection),
+		routerClient: routerrpc.NewRouterClient(connection),
+		ctx:          context.Background(),
+		invoices:     invoices,
 	}
 }
 
 func (client *LndClient) createInvoice(msats int64, memo string, descriptionHash []byte) (*Invoice, error) {
+	preimage := make([]byte, 32)
+	if _, err := rand.Read(preimage); err != nil {
+		return nil, err
+	}
+
 	lnInvoice := lnrpc.Invoice{
 		Memo:            memo,
+		RPreimage:       preimage,
 		DescriptionHash: descriptionHash,
 		ValueMsat:       msats,
 		Expiry:          invoiceExpiryInSeconds,
@@ -159,6 +209,43 @@ func (client *LndClient) getInvoice(paymentHash PaymentHash) *Invoice {
 	return &invoice
 }
 
+func (client *LndClient) newAddress() (string, error) {
+	addressRequest := lnrpc.NewAddressRequest{Type: lnrpc.AddressType_WITNESS_PUBKEY_HASH}
+	addressResponse, err := client.lnClient.NewAddress(client.ctx, &addressRequest)
+	if err != nil {
+		return "", err
+	}
+
+	return addressResponse.Address, nil
+}
+
+func (client *LndClient) getOnChainReceipts() (map[string]OnChainReceipt, error) {
+	transactions, err := client.lnClient.GetTransactions(client.ctx, &lnrpc.GetTransactionsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := map[string]OnChainReceipt{}
+	for _, transaction := range transactions.Transactions {
+		for _, output := range transaction.OutputDetails {
+			if !output.IsOurAddress || output.Address == "" {
+				continue
+			}
+			receipt, receiptExists := receipts[output.Address]
+			if !receiptExists || transaction.NumConfirmations < receipt.confirmations {
+				receipt.confirmations = transaction.NumConfirmations
+			}
+			if timestamp := time.Unix(transaction.TimeStamp, 0); timestamp.After(receipt.timestamp) {
+				receipt.timestamp = timestamp
+			}
+			receipt.amount += output.Amount
+			receipts[output.Address] = receipt
+		}
+	}
+
+	return receipts, nil
+}
+
 func (client *LndClient) decodePaymentRequest(paymentRequest string) (PaymentHash, int64) {
 	payReqString := lnrpc.PayReqString{PayReq: paymentRequest}
 	payReq, err := client.lnClient.DecodePayReq(client.ctx, &payReqString)
@@ -170,12 +257,58 @@ func (client *LndClient) decodePaymentRequest(paymentRequest string) (PaymentHas
 	return PaymentHash(payReq.PaymentHash), payReq.NumSatoshis
 }
 
-func (client *LndClient) sendPayment(paymentRequest string, feeLimit int64) error {
-	sendRequest := lnrpc.SendRequest{
+func (client *LndClient) sendPayment(paymentRequest string, feeLimit int64) (PaymentStream, error) {
+	sendRequest := routerrpc.SendPaymentRequest{
 		PaymentRequest: paymentRequest,
-		FeeLimit:       &lnrpc.FeeLimit{Limit: &lnrpc.FeeLimit_Fixed{Fixed: feeLimit}},
+		FeeLimitSat:    feeLimit,
+		TimeoutSeconds: paymentTimeoutSeconds,
+	}
+	stream, err := client.routerClient.SendPaymentV2(client.ctx, &sendRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentStream(stream.Recv), nil
+}
+
+func (client *LndClient) trackPayment(paymentHash PaymentHash) (PaymentStream, error) {
+	trackRequest := routerrpc.TrackPaymentRequest{PaymentHash: paymentHash.bytes()}
+	stream, err := client.routerClient.TrackPaymentV2(client.ctx, &trackRequest)
+	if err != nil {
+		return nil, err
 	}
-	_, err := client.lnClient.SendPaymentSync(client.ctx, &sendRequest)
 
-	return err
+	return paymentStream(stream.Recv), nil
+}
+
+func paymentStream(recv func() (*lnrpc.Payment, error)) PaymentStream {
+	return func() (*Payment, error) {
+		lnPayment, err := recv()
+		if status.Code(err) == codes.NotFound {
+			return nil, errPaymentNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		payment := Payment{
+			paymentHash: PaymentHash(lnPayment.PaymentHash),
+			status:      PaymentInFlight,
+			fee:         lnPayment.FeeSat,
+		}
+		switch lnPayment.Status {
+		case lnrpc.Payment_SUCCEEDED:
+			payment.status = PaymentSucceeded
+		case lnrpc.Payment_FAILED:
+			payment.status = PaymentFailed
+			payment.failureReason = paymentFailureReason(lnPayment.FailureReason)
+		}
+
+		return &payment, nil
+	}
+}
+
+func paymentFailureReason(reason lnrpc.PaymentFailureReason) string {
+	reasonName := strings.TrimPrefix(reason.String(), "FAILURE_REASON_")
+	return strings.ReplaceAll(strings.ToLower(reasonName), "_", " ")
 }
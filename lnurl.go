@@ -1,30 +1,216 @@
 package main
 
-import "github.com/fiatjaf/go-lnurl"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fiatjaf/go-lnurl"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	payRequestTag           = "payRequest"
+	withdrawRequestTag      = "withdrawRequest"
+	tagParam                = "tag"
+	k1Param                 = "k1"
+	sigParam                = "sig"
+	keyParam                = "key"
+	amountParam             = "amount"
+	commentParam            = "comment"
+	nostrParam              = "nostr"
+	prParam                 = "pr"
+	quantityParam           = "quantity"
+	sizeParam               = "size"
+	callbackParam           = "callback"
+	minWithdrawableParam    = "minWithdrawable"
+	maxWithdrawableParam    = "maxWithdrawable"
+	defaultDescriptionParam = "defaultDescription"
+	payLinkParam            = "payLink"
+	payerDataParam          = "payerdata"
+	encodingParam           = "encoding"
+	formatParam             = "format"
+	levelParam              = "level"
+	borderParam             = "border"
+	colorParam              = "color"
+	backgroundParam         = "background"
+)
+
+const (
+	payScheme      = "lnurlp"
+	withdrawScheme = "lnurlw"
+	authScheme     = "keyauth"
+)
+
+const (
+	LnUrlEncodingBech32 LnUrlEncoding = "bech32"
+	LnUrlEncodingLud17  LnUrlEncoding = "lud17"
+)
+
+type LnUrlEncoding string
+
+func (encoding LnUrlEncoding) isValid() bool {
+	return encoding == "" || encoding == LnUrlEncodingBech32 || encoding == LnUrlEncodingLud17
+}
+
+type LnUrlEncodingConfig struct {
+	Pay      LnUrlEncoding
+	Withdraw LnUrlEncoding
+	Auth     LnUrlEncoding
+}
+
+func (config *LnUrlEncodingConfig) get(lnUrlScheme string) LnUrlEncoding {
+	var encoding LnUrlEncoding
+	switch lnUrlScheme {
+	case payScheme:
+		encoding = config.Pay
+	case withdrawScheme:
+		encoding = config.Withdraw
+	case authScheme:
+		encoding = config.Auth
+	}
+	if encoding == "" {
+		return LnUrlEncodingBech32
+	}
+	return encoding
+}
+
+func (config *LnUrlEncodingConfig) isValid() bool {
+	return config.Pay.isValid() && config.Withdraw.isValid() && config.Auth.isValid()
+}
+
+func encodeLnUrl(rawUrl string, lnUrlScheme string, encoding LnUrlEncoding) (string, error) {
+	if encoding == LnUrlEncodingLud17 {
+		_, address, found := strings.Cut(rawUrl, "://")
+		if !found {
+			return "", errors.New("invalid URL: " + rawUrl)
+		}
+		return lnUrlScheme + "://" + address, nil
+	}
+
+	return lnurl.LNURLEncode(rawUrl)
+}
+
+func lnUrlUri(lnUrl string) string {
+	if strings.Contains(lnUrl, "://") {
+		return lnUrl
+	}
+	return "lightning:" + lnUrl
+}
+
+const (
+	defaultSecretDescription = "Your secret"
+	maxHostLength            = 253
+	maxMetadataSize          = 128 * 1024
+)
 
 const (
-	payRequestTag      = "payRequest"
-	withdrawRequestTag = "withdrawRequest"
-	k1Param            = "k1"
-	sigParam           = "sig"
-	keyParam           = "key"
-	amountParam        = "amount"
-	commentParam       = "comment"
-	nostrParam         = "nostr"
-	prParam            = "pr"
-	quantityParam      = "quantity"
-	sizeParam          = "size"
+	IdentifierTypeIdentifier IdentifierType = "identifier"
+	IdentifierTypeEmail      IdentifierType = "email"
+	IdentifierTypeNone       IdentifierType = "none"
 )
 
+type IdentifierType string
+
+func (identifierType IdentifierType) isValid() bool {
+	switch identifierType {
+	case "", IdentifierTypeIdentifier, IdentifierTypeEmail, IdentifierTypeNone:
+		return true
+	}
+	return false
+}
+
+type LnUrlMetadata struct {
+	Description     string
+	LongDescription string
+	Thumbnails      []*Thumbnail
+	Identifier      string
+	IdentifierType  IdentifierType
+}
+
+// newAccountMetadata always includes the identifier for lightning addresses, as LUD-16 requires it.
+func newAccountMetadata(accountKey AccountKey, account *Account, host string, thumbnails []*Thumbnail,
+	lightningAddress bool) *LnUrlMetadata {
+
+	identifierType := account.getIdentifierType()
+	if identifierType == IdentifierTypeNone && lightningAddress {
+		identifierType = IdentifierTypeIdentifier
+	}
+
+	return &LnUrlMetadata{
+		Description:     account.Description,
+		LongDescription: account.LongDescription,
+		Thumbnails:      thumbnails,
+		Identifier:      string(accountKey) + "@" + host,
+		IdentifierType:  identifierType,
+	}
+}
+
+func (metadata *LnUrlMetadata) entries() [][]string {
+	entries := [][]string{{"text/plain", metadata.Description}}
+	if metadata.LongDescription != "" {
+		entries = append(entries, []string{"text/long-desc", metadata.LongDescription})
+	}
+	for _, thumbnail := range metadata.Thumbnails {
+		entries = append(entries, []string{"image/" + thumbnail.ext + ";base64", base64.StdEncoding.EncodeToString(thumbnail.bytes)})
+	}
+	if metadata.IdentifierType != IdentifierTypeNone {
+		entries = append(entries, []string{"text/" + string(metadata.IdentifierType), metadata.Identifier})
+	}
+	return entries
+}
+
+func (metadata *LnUrlMetadata) Encode() string {
+	encodedMetadata, _ := json.Marshal(metadata.entries())
+	return string(encodedMetadata)
+}
+
+func (metadata *LnUrlMetadata) validate() error {
+	encodedMetadata := metadata.Encode()
+	if len(encodedMetadata) > maxMetadataSize {
+		return fmt.Errorf("metadata size %d exceeds %d bytes", len(encodedMetadata), maxMetadataSize)
+	}
+
+	return nil
+}
+
 type LnUrlPayParams struct {
-	Callback        string `json:"callback"`
-	MinSendable     int64  `json:"minSendable"`
-	MaxSendable     int64  `json:"maxSendable"`
-	EncodedMetadata string `json:"metadata"`
-	CommentAllowed  int64  `json:"commentAllowed"`
-	AllowsNostr     bool   `json:"allowsNostr"`
-	NostrPubkey     string `json:"nostrPubkey,omitempty"`
-	Tag             string `json:"tag"`
+	Callback        string              `json:"callback"`
+	MinSendable     int64               `json:"minSendable"`
+	MaxSendable     int64               `json:"maxSendable"`
+	EncodedMetadata string              `json:"metadata"`
+	CommentAllowed  int64               `json:"commentAllowed"`
+	AllowsNostr     bool                `json:"allowsNostr"`
+	NostrPubkey     string              `json:"nostrPubkey,omitempty"`
+	PayerData       *LnUrlPayerDataSpec `json:"payerData,omitempty"`
+	Tag             string              `json:"tag"`
+}
+
+type LnUrlPayValues struct {
+	lnurl.LNURLPayValues
+	Verify string `json:"verify,omitempty"`
+}
+
+type LnUrlVerifyResponse struct {
+	lnurl.LNURLResponse
+	Settled  bool    `json:"settled"`
+	Preimage *string `json:"preimage"`
+	PR       string  `json:"pr"`
+}
+
+func newLnUrlVerifyResponse(invoice *Invoice) LnUrlVerifyResponse {
+	response := LnUrlVerifyResponse{
+		LNURLResponse: lnurl.OkResponse(),
+		Settled:       invoice.isSettled(),
+		PR:            invoice.paymentRequest,
+	}
+	if response.Settled {
+		response.Preimage = &invoice.preimage
+	}
+
+	return response
 }
 
 func successMessage(message string) *lnurl.SuccessAction {
@@ -33,3 +219,58 @@ func successMessage(message string) *lnurl.SuccessAction {
 		Message: message,
 	}
 }
+
+func aesSuccessAction(description string, content string, invoice *Invoice) (*lnurl.SuccessAction, error) {
+	preimage, err := invoice.preimageBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return lnurl.AESAction(description, preimage, content)
+}
+
+func accountSuccessAction(account *Account, invoice *Invoice) (*lnurl.SuccessAction, error) {
+	message := strings.TrimSpace(account.SuccessMessage)
+	switch {
+	case account.SuccessSecret != "":
+		if message == "" {
+			message = defaultSecretDescription
+		}
+		return aesSuccessAction(message, account.SuccessSecret, invoice)
+	case account.SuccessUrl != "":
+		return lnurl.Action(message, account.SuccessUrl), nil
+	case message != "":
+		return successMessage(message), nil
+	}
+
+	return nil, nil
+}
+
+func isLnUrlPayTarget(target string) bool {
+	if _, _, ok := lnurl.ParseInternetIdentifier(target); ok {
+		return true
+	}
+	if strings.HasPrefix(target, "lnurlp://") {
+		return true
+	}
+	if lnUrl, ok := lnurl.FindLNURLInText(target); ok {
+		_, err := lnurl.LNURLDecode(lnUrl)
+		return err == nil
+	}
+	return false
+}
+
+func fastWithdrawQuery(response lnurl.LNURLWithdrawResponse) string {
+	query := url.Values{}
+	query.Set(tagParam, response.Tag)
+	query.Set(k1Param, response.K1)
+	query.Set(callbackParam, response.Callback)
+	query.Set(minWithdrawableParam, strconv.FormatInt(response.MinWithdrawable, 10))
+	query.Set(maxWithdrawableParam, strconv.FormatInt(response.MaxWithdrawable, 10))
+	query.Set(defaultDescriptionParam, response.DefaultDescription)
+	if response.PayLink != "" {
+		query.Set(payLinkParam, response.PayLink)
+	}
+
+	return query.Encode()
+}
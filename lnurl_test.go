@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/fiatjaf/go-lnurl"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFastWithdrawQuery(t *testing.T) {
+	response := lnurl.LNURLWithdrawResponse{
+		Tag:                withdrawRequestTag,
+		K1:                 "bdc2b0f6be2d4ed1d5bdd2c9d1d6d26e6f0a8fa8b64ad4be8d9e4a3f2d7c6b5a",
+		Callback:           "https://lnurld.example.com/ln/withdraw",
+		MinWithdrawable:    2_079_000,
+		MaxWithdrawable:    2_079_000,
+		DefaultDescription: "Free coffee & cake",
+		PayLink:            "lnurlp://lnurld.example.com/ln/pay/cafe",
+	}
+
+	query, err := url.ParseQuery(fastWithdrawQuery(response))
+	assert.NoError(t, err)
+	params, ok := lnurl.HandleFastWithdraw(query)
+	assert.True(t, ok)
+
+	withdrawResponse := params.(lnurl.LNURLWithdrawResponse)
+	withdrawResponse.CallbackURL = nil
+	assert.Equal(t, response, withdrawResponse)
+	assert.Equal(t, withdrawRequestTag, query.Get(tagParam))
+
+	response.PayLink = ""
+	assert.NotContains(t, fastWithdrawQuery(response), payLinkParam)
+}
+
+func TestIsLnUrlPayTarget(t *testing.T) {
+	assert.True(t, isLnUrlPayTarget("satoshi@nakamoto.example"))
+	assert.True(t, isLnUrlPayTarget("lnurlp://nakamoto.example/ln/pay/satoshi"))
+	lnUrl, err := lnurl.LNURLEncode("https://nakamoto.example/ln/pay/satoshi")
+	assert.NoError(t, err)
+	assert.True(t, isLnUrlPayTarget(lnUrl))
+	assert.False(t, isLnUrlPayTarget("satoshi"))
+	assert.False(t, isLnUrlPayTarget("https://nakamoto.example/ln/pay/satoshi"))
+	assert.False(t, isLnUrlPayTarget("lnurl1invalid"))
+}
+
+func TestLnUrlVerifyResponse(t *testing.T) {
+	invoice := Invoice{preimage: "00ff", paymentRequest: "lnbc1"}
+	assert.JSONEq(t, `{"status":"OK","settled":false,"preimage":null,"pr":"lnbc1"}`, toJson(t, newLnUrlVerifyResponse(&invoice)))
+
+	invoice.settleDate = time.Now()
+	assert.JSONEq(t, `{"status":"OK","settled":true,"preimage":"00ff","pr":"lnbc1"}`, toJson(t, newLnUrlVerifyResponse(&invoice)))
+}
+
+func TestAccountSuccessAction(t *testing.T) {
+	invoice := Invoice{preimage: "3f9b9d4a7c2e8f1b6a5d0c4e3b2a19f8e7d6c5b4a39281706f5e4d3c2b1a0f9e"}
+
+	successAction, err := accountSuccessAction(&Account{}, &invoice)
+	assert.NoError(t, err)
+	assert.Nil(t, successAction)
+
+	successAction, err = accountSuccessAction(&Account{SuccessMessage: "Thanks!"}, &invoice)
+	assert.NoError(t, err)
+	assert.Equal(t, successMessage("Thanks!"), successAction)
+
+	successAction, err = accountSuccessAction(&Account{SuccessMessage: "Download", SuccessUrl: "https://shop.example/ebook"}, &invoice)
+	assert.NoError(t, err)
+	assert.Equal(t, &lnurl.SuccessAction{Tag: "url", Description: "Download", URL: "https://shop.example/ebook"}, successAction)
+
+	successAction, err = accountSuccessAction(&Account{SuccessSecret: "WIFI-PASSWORD"}, &invoice)
+	assert.NoError(t, err)
+	assert.Equal(t, "aes", successAction.Tag)
+	assert.Equal(t, defaultSecretDescription, successAction.Description)
+	preimage, _ := hex.DecodeString(invoice.preimage)
+	secret, err := successAction.Decipher(preimage)
+	assert.NoError(t, err)
+	assert.Equal(t, "WIFI-PASSWORD", secret)
+
+	_, err = accountSuccessAction(&Account{SuccessSecret: "WIFI-PASSWORD"}, &Invoice{})
+	assert.Error(t, err)
+}
+
+func TestLnUrlMetadata(t *testing.T) {
+	thumbnail := Thumbnail{bytes: []byte{0x89, 0x50, 0x4e, 0x47}, ext: "png"}
+	account := Account{Description: "Satoshi", LongDescription: "Tips for Satoshi", IsAlsoEmail: true}
+	metadata := newAccountMetadata("satoshi", &account, "nakamoto.example", []*Thumbnail{&thumbnail}, false)
+
+	var lnurlMetadata lnurl.Metadata
+	lnurlMetadata.Description = "Satoshi"
+	lnurlMetadata.LongDescription = "Tips for Satoshi"
+	lnurlMetadata.Image.Bytes = thumbnail.bytes
+	lnurlMetadata.Image.Ext = thumbnail.ext
+	lnurlMetadata.LightningAddress = "satoshi@nakamoto.example"
+	lnurlMetadata.IsEmail = true
+	assert.Equal(t, lnurlMetadata.Encode(), metadata.Encode())
+	assert.NoError(t, metadata.validate())
+
+	metadata.Thumbnails = append(metadata.Thumbnails, &Thumbnail{bytes: []byte{0xff, 0xd8, 0xff}, ext: "jpeg"})
+	metadata.IdentifierType = IdentifierTypeNone
+	assert.Equal(t, `[["text/plain","Satoshi"],["text/long-desc","Tips for Satoshi"],["image/png;base64","iVBORw=="],["image/jpeg;base64","/9j/"]]`, metadata.Encode())
+
+	metadata.LongDescription = strings.Repeat("x", maxMetadataSize)
+	assert.Error(t, metadata.validate())
+
+	account = Account{Description: "Satoshi", IdentifierType: IdentifierTypeNone}
+	metadata = newAccountMetadata("satoshi", &account, "nakamoto.example", nil, false)
+	assert.Equal(t, `[["text/plain","Satoshi"]]`, metadata.Encode())
+	metadata = newAccountMetadata("satoshi", &account, "nakamoto.example", nil, true)
+	assert.Equal(t, `[["text/plain","Satoshi"],["text/identifier","satoshi@nakamoto.example"]]`, metadata.Encode())
+}
+
+func TestAccountIdentifierType(t *testing.T) {
+	assert.Equal(t, IdentifierTypeIdentifier, (&Account{}).getIdentifierType())
+	assert.Equal(t, IdentifierTypeEmail, (&Account{IsAlsoEmail: true}).getIdentifierType())
+	assert.Equal(t, IdentifierTypeNone, (&Account{IdentifierType: IdentifierTypeNone}).getIdentifierType())
+	assert.False(t, IdentifierType("phone").isValid())
+}
+
+func toJson(t *testing.T, value any) string {
+	data, err := json.Marshal(value)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestEncodeLnUrl(t *testing.T) {
+	rawUrl := "https://nakamoto.example/ln/pay/satoshi"
+
+	lnUrl, err := encodeLnUrl(rawUrl, payScheme, LnUrlEncodingBech32)
+	assert.NoError(t, err)
+	decodedUrl, err := lnurl.LNURLDecode(lnUrl)
+	assert.NoError(t, err)
+	assert.Equal(t, rawUrl, decodedUrl)
+	assert.Equal(t, "lightning:"+lnUrl, lnUrlUri(lnUrl))
+
+	lnUrl, err = encodeLnUrl("https://nakamoto.example/ln/auth?tag=login&k1=00", authScheme, LnUrlEncodingLud17)
+	assert.NoError(t, err)
+	assert.Equal(t, "keyauth://nakamoto.example/ln/auth?tag=login&k1=00", lnUrl)
+	assert.Equal(t, lnUrl, lnUrlUri(lnUrl))
+}
+
+func TestLnUrlEncodingConfig(t *testing.T) {
+	config := LnUrlEncodingConfig{Pay: LnUrlEncodingLud17}
+	assert.Equal(t, LnUrlEncodingLud17, config.get(payScheme))
+	assert.Equal(t, LnUrlEncodingBech32, config.get(withdrawScheme))
+	assert.True(t, config.isValid())
+
+	config.Auth = "bech64"
+	assert.False(t, config.isValid())
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"crypto/sha256"
 	"embed"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -14,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fiatjaf/go-lnurl"
@@ -26,6 +31,7 @@ import (
 type LnUrlData struct {
 	K1     string `json:"k1"`
 	LnUrl  string `json:"lnUrl"`
+	Uri    string `json:"uri"`
 	QrCode string `json:"qrCode"`
 }
 
@@ -39,30 +45,65 @@ type AccountSummary struct {
 }
 
 type AccountInvoice struct {
-	Amount     int64
-	SettleDate time.Time
-	Comment    string
-	IsNew      bool
+	PaymentHash     PaymentHash
+	Amount          int64
+	Refunded        int64
+	SettleDate      time.Time
+	Comment         string
+	Payer           string
+	User            UserKey
+	EnteredAmount   float64
+	EnteredCurrency Currency
+	OnChain         bool
+	Confirmed       bool
+	IsNew           bool
 }
 
 type InvoiceRequest struct {
-	AccountKey AccountKey `json:"accountKey"`
-	Amount     string     `json:"amount"`
+	AccountKey AccountKey           `json:"accountKey"`
+	Amount     string               `json:"amount"`
+	Currency   Currency             `json:"currency"`
+	Items      []InvoiceRequestItem `json:"items"`
+	Tip        TipPreset            `json:"tip"`
+	OnChain    bool                 `json:"onChain"`
+}
+
+type RefundRequest struct {
+	PaymentHash PaymentHash `json:"paymentHash" binding:"required"`
+	Amount      float64     `json:"amount" binding:"gt=0"`
+	Fiat        bool        `json:"fiat"`
+}
+
+type CardPaymentRequest struct {
+	Url string `json:"url" binding:"required"`
+}
+
+type CardQrCode struct {
+	Content string `json:"content"`
+	QrCode  string `json:"qrCode"`
 }
 
 type InvoiceResponse struct {
 	PaymentHash PaymentHash `json:"paymentHash"`
+	Address     string      `json:"address,omitempty"`
 	QrCode      string      `json:"qrCode"`
 }
 
 type InvoiceStatus struct {
-	Settled bool `json:"settled"`
+	Settled bool            `json:"settled"`
+	OnChain *OnChainPayment `json:"onChain,omitempty"`
+}
+
+type AddressResponse struct {
+	Address string `json:"address"`
+	QrCode  string `json:"qrCode"`
 }
 
 const (
-	sessionIdentityKey = "identity"
-	sessionTokenKey    = "token"
-	qrCodeSize         = 1280
+	sessionIdentityKey   = "identity"
+	sessionTokenKey      = "token"
+	qrCodeSize           = 1280
+	lightningAddressPath = "/.well-known/lnurlp/:name"
 )
 
 var (
@@ -79,30 +120,62 @@ var (
 	authenticationService *AuthenticationService
 	withdrawalService     *WithdrawalService
 	raffleService         *RaffleService
+	voucherService        *VoucherService
+	accountService        *AccountService
+	forwardingService     *ForwardingService
+	splitService          *SplitService
+	payerDataService      *PayerDataService
+	onChainService        *OnChainService
 	nostrService          *NostrService
 	ratesService          *RatesService
+	cardService           *CardService
+
+	// shiftMutex serializes opening and closing shifts and recording their invoices
+	shiftMutex sync.Mutex
 )
 
 func main() {
-	var configFileName string
+	var configFileName, bip353ZoneDomain, bip353VerifyDomain string
 
 	flagSet := flag.NewFlagSet("LNURL Daemon", flag.ExitOnError)
 	flagSet.StringVar(&configFileName, "config", "/etc/lnurld/config.yaml", "Path to a YAML config file.")
+	flagSet.StringVar(&bip353ZoneDomain, "bip353-zone", "", "Print BIP-353 TXT records for the given domain and exit.")
+	flagSet.StringVar(&bip353VerifyDomain, "bip353-verify", "", "Verify BIP-353 TXT records of the given domain and exit.")
 	if err := flagSet.Parse(os.Args[1:]); err != nil {
 		log.Fatal(err)
 	}
 
 	config = loadConfig(configFileName)
+	if bip353ZoneDomain != "" {
+		printBip353Zone(bip353ZoneDomain)
+		return
+	}
+	if bip353VerifyDomain != "" {
+		verifyBip353Zone(bip353VerifyDomain)
+		return
+	}
+
 	repository = newRepository(config.ThumbnailDir, config.DataDir)
 	lndClient = newLndClient(config.Lnd)
-	authenticationService = newAuthenticationService(config.Credentials, config.Authentication)
-	withdrawalService = newWithdrawalService(config.Withdrawal)
+	authenticationService = newAuthenticationService(config.Credentials, config.Operators, config.cookieKey(),
+		config.Authentication)
+	withdrawalService = newWithdrawalService(config.Withdrawal, repository, lndClient)
 	raffleService = newRaffleService(repository, lndClient)
+	onChainService = newOnChainService(repository, lndClient)
+	accountService = newAccountService(config.Accounts, repository, lndClient, withdrawalService, onChainService)
+	voucherService = newVoucherService(repository, accountService, withdrawalService)
+	forwardingService = newForwardingService(config.Accounts, repository, lndClient, accountService, withdrawalService)
+	splitService = newSplitService(config.Accounts, repository, lndClient, forwardingService)
+	payerDataService = newPayerDataService()
 	nostrService = newNostrService(config.DataDir, config.Nostr)
 	ratesService = newRatesService(30 * time.Second)
+	cardService = newCardService(config.Withdrawal.RequestExpiry, repository, lndClient, accountService, withdrawalService)
 
 	lnurld := gin.Default()
-	_ = lnurld.SetTrustedProxies(nil)
+	lnurld.RemoteIPHeaders = []string{"X-Real-IP"}
+	if err := lnurld.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies: ", err)
+	}
 	loadTemplates(lnurld, "files/templates/*.gohtml")
 
 	lnurld.NoRoute(abortWithNotFoundResponse)
@@ -112,13 +185,19 @@ func main() {
 	public.POST("/ln/auth", lnAuthInitHandler)
 	public.GET("/ln/auth", lnAuthVerifyHandler)
 	public.GET("/ln/auth/:k1", lnAuthIdentityHandler)
-	public.GET("/.well-known/lnurlp/:name", lnPayHandler)
+	public.GET(lightningAddressPath, lnPayHandler)
+	public.GET("/.well-known/nostr.json", nostrJsonHandler)
 	public.GET("/ln/pay/:name", lnPayHandler)
 	public.GET("/ln/pay/:name/qr-code", lnPayQrCodeHandler)
+	public.GET("/ln/pay/:name/verify/:paymentHash", lnPayVerifyHandler)
 	public.GET("/ln/raffle/:id", lnRaffleTicketHandler)
 	public.GET("/ln/raffle/:id/qr-code", lnRaffleQrCodeHandler)
+	public.GET("/ln/raffle/:id/verify/:paymentHash", lnRaffleVerifyHandler)
 	public.GET("/ln/withdraw", lnWithdrawConfirmHandler)
 	public.GET("/ln/withdraw/:k1", lnWithdrawRequestHandler)
+	public.GET("/ln/cards/:id", lnCardHandler)
+	public.GET("/ln/cards/:id/callback", lnCardCallbackHandler)
+	public.GET("/ln/cards/:id/keys", lnCardKeysHandler)
 	public.GET("/events/:id", eventHandler)
 	public.GET("/events/:id/ics", eventIcsHandler)
 	public.POST("/events/:id/sign-up", eventSignUpHandler)
@@ -128,19 +207,46 @@ func main() {
 	authentication := lnurld.Group("/", sessionHandler("session", 7), noCacheHandler)
 	authentication.GET("/login", loginFormHandler)
 	authentication.POST("/login", loginSubmitHandler)
+	authentication.POST("/login/pin", loginPinSubmitHandler)
+	authentication.POST("/logout", logoutHandler)
+
+	terminal := authentication.Group("/", authTerminalAuthorizationHandler)
+	terminal.GET("/auth/accounts/:name/terminal", authAccountTerminalHandler)
+	terminal.GET("/auth/accounts/:name/receipts/:paymentHash/pdf", authAccountReceiptHandler)
+	terminal.GET("/auth/accounts/:name/products/:id/image", authAccountProductImageHandler)
+	terminal.POST("/api/accounts/:name/receipts/:paymentHash/print", apiAccountReceiptPrintHandler)
+	terminal.POST("/api/accounts/:name/shifts", apiAccountShiftOpenHandler)
+	terminal.POST("/api/accounts/:name/shifts/:id/close", apiAccountShiftCloseHandler)
+	terminal.POST("/api/invoices", apiInvoicesHandler)
+	terminal.GET("/api/invoices/:paymentHash", apiInvoiceStatusHandler)
+	terminal.POST("/api/invoices/:paymentHash/card", apiInvoiceCardPaymentHandler)
 
 	authorized := authentication.Group("/", authAuthorizationHandler)
 	authorized.GET("/auth", authHomeHandler)
 	authorized.GET("/auth/accounts", authAccountsHandler)
 	authorized.GET("/auth/accounts/:name", authAccountHandler)
-	authorized.GET("/auth/accounts/:name/terminal", authAccountTerminalHandler)
+	authorized.GET("/auth/accounts/:name/products", authAccountProductsHandler)
+	authorized.GET("/auth/accounts/:name/shifts/:id/:format", authAccountShiftReportHandler)
 	authorized.GET("/auth/events", authEventsHandler)
 	authorized.GET("/auth/raffles", authRafflesHandler)
 	authorized.GET("/auth/raffles/:id", authRaffleHandler)
 	authorized.GET("/auth/raffles/:id/draw", authRaffleDrawHandler)
+	authorized.GET("/auth/cards", authCardsHandler)
+	authorized.GET("/auth/vouchers", authVouchersHandler)
+	authorized.GET("/auth/vouchers/:id", authVoucherBatchHandler)
+	authorized.GET("/auth/vouchers/:id/print", authVoucherBatchPrintHandler)
+	authorized.GET("/auth/vouchers/:id/qr-codes/:k1", authVoucherQrCodeHandler)
 	authorized.POST("/api/accounts/:name/archive", apiAccountArchiveHandler)
-	authorized.POST("/api/invoices", apiInvoicesHandler)
-	authorized.GET("/api/invoices/:paymentHash", apiInvoiceStatusHandler)
+	authorized.POST("/api/accounts/:name/addresses", apiAccountAddressCreateHandler)
+	authorized.POST("/api/accounts/:name/products", apiAccountProductCreateHandler)
+	authorized.GET("/api/accounts/:name/products/:id", apiAccountProductReadHandler)
+	authorized.PUT("/api/accounts/:name/products/:id", apiAccountProductUpdateHandler)
+	authorized.DELETE("/api/accounts/:name/products/:id", apiAccountProductDeleteHandler)
+	authorized.POST("/api/accounts/:name/refunds", apiAccountRefundCreateHandler)
+	authorized.POST("/api/accounts/:name/withdrawals", apiAccountWithdrawalCreateHandler)
+	authorized.POST("/api/accounts/:name/withdrawals/:id/withdraw", apiAccountWithdrawHandler)
+	authorized.POST("/api/accounts/:name/withdrawals/:id/approve", apiAccountWithdrawalApproveHandler)
+	authorized.POST("/api/accounts/:name/withdrawals/:id/cancel", apiAccountWithdrawalCancelHandler)
 	authorized.POST("/api/events", apiEventCreateHandler)
 	authorized.GET("/api/events/:id", apiEventReadHandler)
 	authorized.PUT("/api/events/:id", apiEventUpdateHandler)
@@ -150,6 +256,12 @@ func main() {
 	authorized.POST("/api/raffles/:id/draw", apiRaffleDrawCommitHandler)
 	authorized.POST("/api/raffles/:id/withdraw", apiRaffleWithdrawHandler)
 	authorized.POST("/api/raffles/:id/lock", apiRaffleLockHandler)
+	authorized.POST("/api/vouchers", apiVoucherBatchCreateHandler)
+	authorized.POST("/api/cards", apiCardCreateHandler)
+	authorized.POST("/api/cards/:id/enable", apiCardEnableHandler)
+	authorized.POST("/api/cards/:id/disable", apiCardDisableHandler)
+	authorized.POST("/api/cards/:id/program", apiCardProgramHandler)
+	authorized.POST("/api/cards/:id/wipe", apiCardWipeHandler)
 
 	log.Fatal(lnurld.Run(config.Listen))
 }
@@ -171,6 +283,31 @@ func noCacheHandler(context *gin.Context) {
 	context.Header("Cache-Control", "no-store, must-revalidate")
 }
 
+func printBip353Zone(domain string) {
+	records, err := bip353Records(config.Accounts, domain)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Print(bip353Zone(records))
+}
+
+func verifyBip353Zone(domain string) {
+	records, err := bip353Records(config.Accounts, domain)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mismatches := verifyBip353Records(records, net.LookupTXT)
+	for _, mismatch := range mismatches {
+		fmt.Println(mismatch)
+	}
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("All", len(records), "BIP-353 records match current config.")
+}
+
 func indexHandler(context *gin.Context) {
 	context.HTML(http.StatusOK, "index.gohtml", gin.H{})
 }
@@ -178,7 +315,7 @@ func indexHandler(context *gin.Context) {
 func lnAuthInitHandler(context *gin.Context) {
 	k1 := authenticationService.generateChallenge()
 
-	generateLnUrl(context, k1, "/ln/auth?tag=login&k1="+k1)
+	generateLnUrl(context, k1, "/ln/auth?tag=login&k1="+k1, authScheme)
 }
 
 func lnAuthVerifyHandler(context *gin.Context) {
@@ -216,16 +353,8 @@ func lnPayHandler(context *gin.Context) {
 	}
 
 	scheme, host := getSchemeAndHost(context)
-	lnurlMetadata := lnurl.Metadata{
-		Description:      account.Description,
-		LightningAddress: string(accountKey) + "@" + host,
-		IsEmail:          account.IsAlsoEmail,
-	}
-
-	if thumbnail := getAccountThumbnail(account); thumbnail != nil {
-		lnurlMetadata.Image.Bytes = thumbnail.bytes
-		lnurlMetadata.Image.Ext = thumbnail.ext
-	}
+	lightningAddress := context.FullPath() == lightningAddressPath
+	lnurlMetadata := newAccountMetadata(accountKey, account, host, getAccountThumbnails(account), lightningAddress)
 
 	amountString := context.Query(amountParam)
 	if amountString == "" {
@@ -242,6 +371,7 @@ func lnPayHandler(context *gin.Context) {
 			CommentAllowed:  int64(account.CommentAllowed),
 			AllowsNostr:     account.AllowsNostr,
 			NostrPubkey:     nostrPubkey,
+			PayerData:       payerDataService.getSpec(accountKey, account.PayerData),
 			Tag:             payRequestTag,
 		})
 		return
@@ -272,11 +402,25 @@ func lnPayHandler(context *gin.Context) {
 		}
 	}
 
+	payerDataJson := context.Query(payerDataParam)
+	if payerDataJson != "" && (zapRequest != nil || !account.PayerData.isEnabled()) {
+		abortWithBadRequestResponse(context, "payer data not allowed")
+		return
+	}
+	var payerData *lnurl.PayerDataValues
+	if account.PayerData.isEnabled() && zapRequest == nil {
+		payerData, err = payerDataService.parse(accountKey, account.PayerData, payerDataJson)
+		if err != nil {
+			abortWithBadRequestResponse(context, "invalid payer data")
+			return
+		}
+	}
+
 	var descriptionBytes []byte
 	if zapRequest != nil {
 		descriptionBytes = zapRequest.Serialize()
 	} else {
-		descriptionBytes = []byte(lnurlMetadata.Encode())
+		descriptionBytes = []byte(lnurlMetadata.Encode() + payerDataJson)
 	}
 
 	descriptionHash := sha256.Sum256(descriptionBytes)
@@ -288,16 +432,26 @@ func lnPayHandler(context *gin.Context) {
 		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing invoice: %w", err))
 		return
 	}
+	if payerDataJson != "" {
+		if err := repository.addAccountPayerData(accountKey, PayerData{invoice.paymentHash, *payerData}); err != nil {
+			abortWithInternalServerErrorResponse(context, fmt.Errorf("storing payer data: %w", err))
+			return
+		}
+	}
 
-	var successAction *lnurl.SuccessAction
-	if strings.TrimSpace(account.SuccessMessage) != "" {
-		successAction = successMessage(account.SuccessMessage)
+	successAction, err := accountSuccessAction(account, invoice)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating success action: %w", err))
+		return
 	}
 
-	context.JSON(http.StatusOK, lnurl.LNURLPayValues{
-		PR:            invoice.paymentRequest,
-		SuccessAction: successAction,
-		Routes:        []string{},
+	context.JSON(http.StatusOK, LnUrlPayValues{
+		LNURLPayValues: lnurl.LNURLPayValues{
+			PR:            invoice.paymentRequest,
+			SuccessAction: successAction,
+			Routes:        []string{},
+		},
+		Verify: scheme + "://" + host + "/ln/pay/" + string(accountKey) + "/verify/" + string(invoice.paymentHash),
 	})
 
 	if zapRequest != nil {
@@ -305,13 +459,40 @@ func lnPayHandler(context *gin.Context) {
 	}
 }
 
+func nostrJsonHandler(context *gin.Context) {
+	context.Header("Access-Control-Allow-Origin", "*")
+	context.JSON(http.StatusOK, wellKnownNostr(config.Accounts, context.Query("name")))
+}
+
+func lnPayVerifyHandler(context *gin.Context) {
+	accountKey, account := getAccount(context)
+	if account == nil {
+		return
+	}
+
+	paymentHash := PaymentHash(context.Param("paymentHash"))
+	if !slices.Contains(repository.getAllAccountInvoices(accountKey), paymentHash) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	verifyInvoice(context, paymentHash)
+}
+
 func lnPayQrCodeHandler(context *gin.Context) {
 	accountKey, account := getAccount(context)
 	if accountKey == "" {
 		return
 	}
 
-	generateQrCode(context, "/ln/pay/"+string(accountKey), getAccountThumbnailData(account))
+	_, host := getSchemeAndHost(context)
+	poster := QrCodePoster{
+		title:       account.Description,
+		address:     string(accountKey) + "@" + host,
+		description: paragraphSeparator.Split(account.LongDescription, -1),
+	}
+
+	generateQrCode(context, "/ln/pay/"+string(accountKey), payScheme, getAccountThumbnailData(account), &poster)
 }
 
 func lnRaffleTicketHandler(context *gin.Context) {
@@ -376,13 +557,40 @@ func lnRaffleTicketHandler(context *gin.Context) {
 		return
 	}
 
-	context.JSON(http.StatusOK, lnurl.LNURLPayValues{
-		PR:            invoice.paymentRequest,
-		SuccessAction: successMessage(raffle.successMessage(tickets)),
-		Routes:        []string{},
+	successAction, err := raffle.successAction(tickets, invoice)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating success action: %w", err))
+		return
+	}
+
+	scheme, host := getSchemeAndHost(context)
+	context.JSON(http.StatusOK, LnUrlPayValues{
+		LNURLPayValues: lnurl.LNURLPayValues{
+			PR:            invoice.paymentRequest,
+			SuccessAction: successAction,
+			Routes:        []string{},
+		},
+		Verify: scheme + "://" + host + "/ln/raffle/" + string(raffle.Id) + "/verify/" + string(invoice.paymentHash),
 	})
 }
 
+func lnRaffleVerifyHandler(context *gin.Context) {
+	raffle := getRaffle(context)
+	if raffle == nil {
+		return
+	}
+
+	paymentHash := PaymentHash(context.Param("paymentHash"))
+	for _, tickets := range repository.getRaffleTickets(raffle) {
+		if tickets.paymentHash == paymentHash {
+			verifyInvoice(context, paymentHash)
+			return
+		}
+	}
+
+	abortWithNotFoundResponse(context)
+}
+
 func lnRaffleQrCodeHandler(context *gin.Context) {
 	raffle := getRaffle(context)
 	if raffle == nil {
@@ -403,12 +611,12 @@ func lnRaffleQrCodeHandler(context *gin.Context) {
 		thumbnailData = thumbnail.bytes
 	}
 
-	generateQrCode(context, lnRaffleTicketUri(raffle, quantity), thumbnailData)
+	generateQrCode(context, lnRaffleTicketUri(raffle, quantity), payScheme, thumbnailData, raffle.poster(quantity))
 }
 
 func lnWithdrawConfirmHandler(context *gin.Context) {
 	k1 := context.Query(k1Param)
-	withdrawalRequest := withdrawalService.getRequest(k1)
+	withdrawalRequest := getWithdrawalRequest(k1)
 	if withdrawalRequest == nil {
 		abortWithNotFoundResponse(context)
 		return
@@ -421,11 +629,12 @@ func lnWithdrawConfirmHandler(context *gin.Context) {
 		return
 	}
 
-	if err := repository.createWithdrawal(withdrawalRequest, paymentHash); err != nil {
+	err := withdrawalService.withdraw(withdrawalRequest, pr, paymentHash)
+	if errors.Is(err, errAlreadyWithdrawn) || errors.Is(err, errWithdrawalCanceled) {
 		abortWithNotFoundResponse(context)
 		return
 	}
-	if err := lndClient.sendPayment(pr, withdrawalRequest.feeLimit); err != nil {
+	if err != nil {
 		abortWithInternalServerErrorResponse(context, err)
 		return
 	}
@@ -436,22 +645,84 @@ func lnWithdrawConfirmHandler(context *gin.Context) {
 
 func lnWithdrawRequestHandler(context *gin.Context) {
 	k1 := context.Param("k1")
-	withdrawalRequest := withdrawalService.getRequest(k1)
+	withdrawalRequest := getWithdrawalRequest(k1)
 	if withdrawalRequest == nil {
 		abortWithNotFoundResponse(context)
 		return
 	}
 
-	scheme, host := getSchemeAndHost(context)
-	withdrawable := msats(withdrawalRequest.amount)
+	context.JSON(http.StatusOK, lnWithdrawResponse(context, k1, withdrawalRequest))
+}
+
+func lnCardHandler(context *gin.Context) {
+	card, k1, err := cardService.tap(CardId(context.Param("id")), context.Query("p"), context.Query("c"))
+	if errors.Is(err, errUnknownCard) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+	if errors.Is(err, errInvalidCardTap) || errors.Is(err, errCardDisabled) {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("verifying card tap: %w", err))
+		return
+	}
+	withdrawable := cardService.getWithdrawable(card)
+	if withdrawable < 1 {
+		abortWithBadRequestResponse(context, errCardLimitExceeded.Error())
+		return
+	}
 
+	scheme, host := getSchemeAndHost(context)
 	context.JSON(http.StatusOK, lnurl.LNURLWithdrawResponse{
 		Tag:                withdrawRequestTag,
 		K1:                 k1,
-		Callback:           scheme + "://" + host + "/ln/withdraw",
-		MinWithdrawable:    withdrawable,
-		MaxWithdrawable:    withdrawable,
-		DefaultDescription: withdrawalRequest.description,
+		Callback:           scheme + "://" + host + "/ln/cards/" + string(card.Id) + "/callback",
+		MinWithdrawable:    msats(1),
+		MaxWithdrawable:    msats(withdrawable),
+		DefaultDescription: card.Name,
+	})
+}
+
+func lnCardCallbackHandler(context *gin.Context) {
+	cardId := CardId(context.Param("id"))
+	err := cardService.pay(cardId, context.Query(k1Param), context.Query(prParam))
+	if errors.Is(err, errUnknownCardTap) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+	if errors.Is(err, errCardDisabled) || errors.Is(err, errCardLimitExceeded) ||
+		errors.Is(err, errInvalidCardInvoice) || errors.Is(err, errInsufficientBalance) {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("paying by card: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusOK, lnurl.OkResponse())
+}
+
+func lnCardKeysHandler(context *gin.Context) {
+	card, err := cardService.claimKeys(CardId(context.Param("id")), context.Query("secret"))
+	if errors.Is(err, errUnknownCard) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("updating card: %w", err))
+		return
+	}
+
+	_, host := getSchemeAndHost(context)
+	context.JSON(http.StatusOK, CardProgramResponse{
+		ProtocolName:    cardProtocolName,
+		ProtocolVersion: cardProtocolVersion,
+		CardName:        card.Name,
+		LnUrlWithdraw:   withdrawScheme + "://" + host + "/ln/cards/" + string(card.Id),
+		CardKeys:        card.Keys,
 	})
 }
 
@@ -526,25 +797,32 @@ func raffleHandler(context *gin.Context) {
 		return
 	}
 
+	encoding := getLnUrlEncoding(context, payScheme)
+	if encoding == "" {
+		return
+	}
+
 	scheme, host := getSchemeAndHost(context)
 
 	var qrCodes []RaffleQrCode
 	if !repository.isRaffleDrawAvailable(raffle) {
 		for quantity := minQuantity; quantity <= maxQuantity; quantity++ {
 			lnRaffleTicketUrl := scheme + "://" + host + lnRaffleTicketUri(raffle, quantity)
-			if lnUrl, err := lnurl.LNURLEncode(lnRaffleTicketUrl); err == nil {
+			if lnUrl, err := encodeLnUrl(lnRaffleTicketUrl, payScheme, encoding); err == nil {
 				qrCodes = append(qrCodes, RaffleQrCode{
-					LnUrl: lnUrl,
-					Uri:   lnRaffleQrCodeUri(raffle, quantity),
+					Link: template.URL(lnUrlUri(lnUrl)),
+					Uri:  lnRaffleQrCodeUri(raffle, quantity, encoding),
 				})
 			}
 		}
 	}
 
 	context.HTML(http.StatusOK, "raffle-public.gohtml", gin.H{
-		"Title":       raffle.Title,
-		"PrizesCount": raffle.PrizesCount(),
-		"QrCodes":     qrCodes,
+		"Title":          raffle.Title,
+		"PrizesCount":    raffle.PrizesCount(),
+		"QrCodes":        qrCodes,
+		"PrizeWinners":   raffleService.getPrizeWinners(raffle),
+		"SkippedTickets": raffleService.getSkippedTickets(raffle),
 	})
 }
 
@@ -559,7 +837,9 @@ func loginFormHandler(context *gin.Context) {
 		return
 	}
 
-	context.HTML(http.StatusOK, "login.gohtml", gin.H{})
+	context.HTML(http.StatusOK, "login.gohtml", gin.H{
+		"OperatorsEnabled": len(config.Operators) > 0,
+	})
 }
 
 func loginSubmitHandler(context *gin.Context) {
@@ -569,6 +849,7 @@ func loginSubmitHandler(context *gin.Context) {
 	if !authenticationService.verifyCredentials(username, password) {
 		context.HTML(http.StatusOK, "login.gohtml", gin.H{
 			"InvalidCredentials": true,
+			"OperatorsEnabled":   len(config.Operators) > 0,
 		})
 		return
 	}
@@ -581,7 +862,61 @@ func loginSubmitHandler(context *gin.Context) {
 	context.Redirect(http.StatusFound, "/auth")
 }
 
+func loginPinSubmitHandler(context *gin.Context) {
+	operator := UserKey(context.PostForm("operator"))
+	pin := context.PostForm("pin")
+
+	// without a forwarded address, requests via a local proxy share its address and are only throttled per operator
+	client := context.ClientIP()
+	if ip := net.ParseIP(client); ip == nil || ip.IsLoopback() {
+		client = ""
+	}
+
+	if err := authenticationService.verifyPin(operator, pin, client); err != nil {
+		context.HTML(http.StatusOK, "login.gohtml", gin.H{
+			"InvalidPin":         errors.Is(err, errInvalidPin),
+			"TooManyPinAttempts": errors.Is(err, errTooManyPinAttempts),
+			"OperatorsEnabled":   true,
+		})
+		return
+	}
+
+	if err := setAuthenticatedUser(context, operator); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating session: %w", err))
+		return
+	}
+
+	context.Redirect(http.StatusFound, "/auth")
+}
+
+func logoutHandler(context *gin.Context) {
+	session := sessions.Default(context)
+	session.Clear()
+	if err := session.Save(); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("clearing session: %w", err))
+		return
+	}
+
+	context.Redirect(http.StatusFound, "/login")
+}
+
 func authAuthorizationHandler(context *gin.Context) {
+	authTerminalAuthorizationHandler(context)
+	if context.IsAborted() || !isOperator(context) {
+		return
+	}
+
+	if context.FullPath() == "/auth" {
+		operatorAccounts := config.Operators[getAuthenticatedUser(context)].Accounts
+		context.Redirect(http.StatusFound, "/auth/accounts/"+string(operatorAccounts[0])+"/terminal")
+		context.Abort()
+		return
+	}
+
+	abortWithNotFoundResponse(context)
+}
+
+func authTerminalAuthorizationHandler(context *gin.Context) {
 	authenticatedUser := getAuthenticatedUser(context)
 	if authenticatedUser == "" {
 		context.Redirect(http.StatusFound, "/login")
@@ -597,7 +932,8 @@ func authAuthorizationHandler(context *gin.Context) {
 
 func authHomeHandler(context *gin.Context) {
 	context.HTML(http.StatusOK, "auth.gohtml", gin.H{
-		"AccountsCount": len(getAccessibleAccounts(context)),
+		"AccountsCount":   len(getAccessibleAccounts(context)),
+		"IsAdministrator": isAdministrator(context),
 	})
 }
 
@@ -633,25 +969,70 @@ func authAccountHandler(context *gin.Context) {
 	invoices := repository.getAccountInvoices(accountKey)
 	invoicesIssued := len(invoices)
 
+	payers := map[PaymentHash]string{}
+	for _, payerData := range repository.getAccountPayerData(accountKey) {
+		payers[payerData.paymentHash] = payerData.summary()
+	}
+
+	refunds := accountService.getRefunds(accountKey)
+
+	invoiceAmounts := map[PaymentHash]InvoiceAmount{}
+	for _, amount := range repository.getAccountInvoiceAmounts(accountKey) {
+		invoiceAmounts[amount.paymentHash] = amount
+	}
+
 	var invoicesSettled int
 	var totalSatsReceived int64
+	var totalSatsRefunded int64
 	var commentsCount int
 	var accountInvoices []AccountInvoice
+	settledInvoices := map[PaymentHash]bool{}
 	for i, paymentHash := range invoices {
 		invoice := lndClient.getInvoice(paymentHash)
 		if invoice != nil && invoice.isSettled() {
 			invoicesSettled++
+			settledInvoices[paymentHash] = true
 			totalSatsReceived += invoice.amount
 			if invoice.memo != "" {
 				commentsCount++
 			}
-			accountInvoices = append(accountInvoices, AccountInvoice{
-				Amount:     invoice.amount,
-				SettleDate: invoice.settleDate,
-				Comment:    invoice.memo,
-				IsNew:      i >= previousInvoicesCount,
-			})
+			accountInvoice := AccountInvoice{
+				PaymentHash: paymentHash,
+				Amount:      invoice.amount,
+				Refunded:    refunds[paymentHash],
+				SettleDate:  invoice.settleDate,
+				Comment:     invoice.memo,
+				Payer:       payers[paymentHash],
+				User:        invoiceAmounts[paymentHash].user,
+				IsNew:       i >= previousInvoicesCount,
+			}
+			if amount := invoiceAmounts[paymentHash]; amount.currency != "" && amount.currency != account.getCurrency() {
+				accountInvoice.EnteredAmount, accountInvoice.EnteredCurrency = amount.amount, amount.currency
+			}
+			accountInvoices = append(accountInvoices, accountInvoice)
+		}
+	}
+
+	for _, payment := range onChainService.getPayments(accountKey) {
+		if payment.Received == 0 {
+			continue
+		}
+		if payment.IsConfirmed {
+			totalSatsReceived += payment.Received
+		}
+		if payment.IsPaid {
+			settledInvoices[payment.PaymentHash] = true
 		}
+		accountInvoices = append(accountInvoices, AccountInvoice{
+			Amount:     payment.Received,
+			SettleDate: payment.Timestamp,
+			OnChain:    true,
+			Confirmed:  payment.IsConfirmed,
+		})
+	}
+
+	for _, amount := range refunds {
+		totalSatsRefunded += amount
 	}
 
 	userState.AccountInvoicesCounts[accountKey] = invoicesIssued
@@ -663,16 +1044,55 @@ func authAccountHandler(context *gin.Context) {
 		return accountInvoices[i].SettleDate.After(accountInvoices[j].SettleDate)
 	})
 
+	isSettled := func(paymentHash PaymentHash) bool {
+		return settledInvoices[paymentHash]
+	}
+	productSales := getProductSales(repository.getAccountInvoiceItems(accountKey), isSettled)
+	tipSummaries := getTipSummaries(repository.getAccountInvoiceTips(accountKey), isSettled)
+
+	withdrawalConfig := account.Withdrawal
+	splits := getSplitSummaries(account.Splits, repository.getAccountLedgerEntries(accountKey))
+	incomingSplits := accountService.getIncomingSplits(accountKey)
+	hasCards := slices.ContainsFunc(repository.getCards(), func(card *Card) bool {
+		return card.AccountKey == accountKey
+	})
+	balanceEnabled := withdrawalConfig.isEnabled() || account.Forwarding.isEnabled() || account.Refundable || hasCards ||
+		len(splits) > 0 || len(incomingSplits) > 0
+	var withdrawals []*AccountWithdrawal
+	var balance int64
+	if balanceEnabled {
+		withdrawals = accountService.getWithdrawals(accountKey)
+		balance = accountService.getBalance(accountKey)
+	}
+
 	context.HTML(http.StatusOK, "account.gohtml", gin.H{
-		"AccountKey":        accountKey,
-		"FiatCurrency":      account.getCurrency(),
-		"InvoicesIssued":    invoicesIssued,
-		"InvoicesSettled":   invoicesSettled,
-		"CommentsCount":     commentsCount,
-		"TotalSatsReceived": totalSatsReceived,
-		"TotalFiatReceived": ratesService.satsToFiat(account.getCurrency(), totalSatsReceived),
-		"Archivable":        account.Archivable && invoicesSettled > 0,
-		"Invoices":          accountInvoices,
+		"AccountKey":         accountKey,
+		"FiatCurrency":       account.getCurrency(),
+		"InvoicesIssued":     invoicesIssued,
+		"InvoicesSettled":    invoicesSettled,
+		"CommentsCount":      commentsCount,
+		"TotalSatsReceived":  totalSatsReceived,
+		"TotalFiatReceived":  ratesService.satsToFiat(account.getCurrency(), totalSatsReceived),
+		"TotalSatsRefunded":  totalSatsRefunded,
+		"Archivable":         account.Archivable && invoicesSettled > 0,
+		"Refundable":         account.Refundable,
+		"Invoices":           accountInvoices,
+		"ProductSales":       productSales,
+		"Shifts":             sortShifts(repository.getAccountShifts(accountKey)),
+		"TipSummaries":       tipSummaries,
+		"OnChainEnabled":     account.OnChain.Enabled,
+		"WithdrawalsEnabled": withdrawalConfig.isEnabled(),
+		"BalanceEnabled":     balanceEnabled,
+		"Balance":            balance,
+		"MinWithdrawal":      max(withdrawalConfig.MinAmount, 1),
+		"MaxWithdrawal":      min(int64(withdrawalConfig.MaxAmount), balance),
+		"Withdrawable":       balance >= int64(max(withdrawalConfig.MinAmount, 1)),
+		"WithdrawalExpiry":   config.Withdrawal.RequestExpiry.Milliseconds(),
+		"Withdrawals":        withdrawals,
+		"Splits":             splits,
+		"IncomingSplits":     incomingSplits,
+		"AuthenticatedUser":  authenticatedUser,
+		"IsAdministrator":    isAdministrator(context),
 	})
 }
 
@@ -682,13 +1102,84 @@ func authAccountTerminalHandler(context *gin.Context) {
 		return
 	}
 
+	var operator UserKey
+	if isOperator(context) {
+		operator = getAuthenticatedUser(context)
+	}
+
 	context.HTML(http.StatusOK, "terminal.gohtml", gin.H{
+		"AccountKey":     accountKey,
+		"Currency":       account.getCurrency(),
+		"Currencies":     append([]Currency{account.getCurrency()}, account.Terminal.Currencies...),
+		"Title":          account.Description,
+		"OnChainEnabled": account.OnChain.Enabled,
+		"Categories":     getProductCategories(repository.getAccountProducts(accountKey)),
+		"Tips":           account.Tips,
+		"Shift":          getOpenShift(accountKey),
+		"PrinterEnabled": account.Receipt.Printer != "",
+		"Operator":       operator,
+		"Terminals":      config.Operators[operator].Accounts,
+	})
+}
+
+func authAccountShiftReportHandler(context *gin.Context) {
+	accountKey, shift := getAccessibleAccountShift(context)
+	if shift == nil {
+		return
+	}
+
+	format := context.Param("format")
+	if shift.IsOpen() || format != "csv" && format != "pdf" {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	fileName := repository.getAccountShiftReportFileName(accountKey, shift, format)
+	context.FileAttachment(fileName, "z-report-"+string(accountKey)+"-"+shift.Closed.Format("20060102150405")+"."+format)
+}
+
+func authAccountReceiptHandler(context *gin.Context) {
+	_, _, receipt := getAccessibleAccountReceipt(context)
+	if receipt == nil {
+		return
+	}
+
+	context.Header("Content-Disposition", `inline; filename="receipt-`+string(receipt.paymentHash[:8])+`.pdf"`)
+	context.Data(http.StatusOK, "application/pdf", receipt.pdf())
+}
+
+func authAccountProductsHandler(context *gin.Context) {
+	accountKey, account := getAccessibleAccount(context)
+	if accountKey == "" {
+		return
+	}
+
+	context.HTML(http.StatusOK, "products.gohtml", gin.H{
 		"AccountKey": accountKey,
 		"Currency":   account.getCurrency(),
-		"Title":      account.Description,
+		"Categories": getProductCategories(repository.getAccountProducts(accountKey)),
 	})
 }
 
+func authAccountProductImageHandler(context *gin.Context) {
+	accountKey, product := getAccessibleAccountProduct(context)
+	if product == nil {
+		return
+	}
+	if !product.HasImage {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	imageData, err := repository.getAccountProductImage(accountKey, product)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("reading product image: %w", err))
+		return
+	}
+
+	context.Data(http.StatusOK, http.DetectContentType(imageData), imageData)
+}
+
 func authEventsHandler(context *gin.Context) {
 	authenticatedUser := getAuthenticatedUser(context)
 
@@ -743,7 +1234,8 @@ func authRaffleHandler(context *gin.Context) {
 
 	drawAvailable := repository.isRaffleDrawAvailable(raffle)
 	drawFinished := repository.isRaffleDrawFinished(raffle)
-	withdrawalFinished := repository.isRaffleWithdrawalFinished(raffle)
+	withdrawal := getRaffleWithdrawal(raffle)
+	withdrawable := isWithdrawable(withdrawal)
 	locked := repository.isRaffleLocked(raffle)
 
 	var ticketsIssued int
@@ -770,10 +1262,11 @@ func authRaffleHandler(context *gin.Context) {
 		"TotalFiatReceived":  ratesService.satsToFiat(raffle.FiatCurrency, totalSatsReceived),
 		"DrawAvailable":      drawAvailable,
 		"DrawFinished":       drawFinished,
-		"Withdrawable":       drawFinished && !withdrawalFinished && !locked,
-		"WithdrawalFinished": withdrawalFinished,
+		"Withdrawable":       drawFinished && withdrawable && !locked,
+		"Withdrawal":         withdrawal,
+		"WithdrawalFinished": withdrawal != nil && withdrawal.IsSucceeded(),
 		"WithdrawalExpiry":   config.Withdrawal.RequestExpiry.Milliseconds(),
-		"Lockable":           drawFinished && !withdrawalFinished && !locked && isAdministrator(context),
+		"Lockable":           drawFinished && withdrawable && !locked && isAdministrator(context),
 	})
 }
 
@@ -785,8 +1278,9 @@ func authRaffleDrawHandler(context *gin.Context) {
 
 	if prizeWinners := raffleService.getPrizeWinners(raffle); prizeWinners != nil {
 		context.HTML(http.StatusOK, "winners.gohtml", gin.H{
-			"Title":        raffle.Title,
-			"PrizeWinners": prizeWinners,
+			"Title":          raffle.Title,
+			"PrizeWinners":   prizeWinners,
+			"SkippedTickets": raffleService.getSkippedTickets(raffle),
 		})
 		return
 	}
@@ -800,44 +1294,544 @@ func authRaffleDrawHandler(context *gin.Context) {
 		"Id":           raffle.Id,
 		"Title":        raffle.Title,
 		"Prizes":       raffle.prizes(),
-		"DrawnTickets": raffleService.getDrawnTickets(raffleDraw),
+		"DrawnTickets": raffleService.getDrawnTickets(raffle, raffleDraw),
 	})
 }
 
-func apiAccountArchiveHandler(context *gin.Context) {
-	accountKey, account := getAccessibleAccount(context)
-	if accountKey == "" {
-		return
+func authVouchersHandler(context *gin.Context) {
+	authenticatedUser := getAuthenticatedUser(context)
+
+	var batches []*VoucherBatch
+	for _, batch := range repository.getVoucherBatches() {
+		if isUserAuthorized(context, batch.Owner) {
+			batch.IsMine = batch.Owner == authenticatedUser
+			batches = append(batches, batch)
+		}
 	}
-	if !account.Archivable {
-		abortWithBadRequestResponse(context, "not archivable")
-		return
+
+	accountBalances := map[AccountKey]int64{}
+	for accountKey := range getAccessibleAccounts(context) {
+		accountBalances[accountKey] = accountService.getBalance(accountKey)
 	}
 
-	err := repository.archiveAccountInvoices(accountKey)
-	if err != nil {
-		abortWithInternalServerErrorResponse(context, fmt.Errorf("archiving storage file: %w", err))
+	context.HTML(http.StatusOK, "vouchers.gohtml", gin.H{
+		"VoucherBatches":  sortVoucherBatches(batches),
+		"AccountBalances": accountBalances,
+	})
+}
+
+func authCardsHandler(context *gin.Context) {
+	if !isAdministrator(context) {
+		abortWithNotFoundResponse(context)
 		return
 	}
 
-	usersWithAccountAccess := config.Administrators
-	for user, allowedAccounts := range config.AccessControl {
-		if slices.Contains(allowedAccounts, accountKey) {
-			usersWithAccountAccess = append(usersWithAccountAccess, user)
-		}
+	cards := repository.getCards()
+	for _, card := range cards {
+		card.Spent = cardService.getSpent(card)
 	}
 
-	for _, user := range usersWithAccountAccess {
-		userState := repository.getUserState(user)
-		if userState.AccountInvoicesCounts[accountKey] > 0 {
-			userState.AccountInvoicesCounts[accountKey] = 0
-			if err := repository.updateUserState(user, userState); err != nil {
-				log.Println("error updating user state:", err)
-			}
-		}
+	var accountKeys []AccountKey
+	for accountKey := range config.Accounts {
+		accountKeys = append(accountKeys, accountKey)
 	}
+	slices.Sort(accountKeys)
 
-	context.Status(http.StatusNoContent)
+	context.HTML(http.StatusOK, "cards.gohtml", gin.H{
+		"Cards":       sortCards(cards),
+		"AccountKeys": accountKeys,
+	})
+}
+
+func authVoucherBatchHandler(context *gin.Context) {
+	batch := getAccessibleVoucherBatch(context)
+	if batch == nil {
+		return
+	}
+
+	vouchers := voucherService.getVouchers(batch)
+
+	var vouchersRedeemed int
+	for _, voucher := range vouchers {
+		if voucher.IsRedeemed() {
+			vouchersRedeemed++
+		}
+	}
+
+	context.HTML(http.StatusOK, "voucher.gohtml", gin.H{
+		"Id":               batch.Id,
+		"Title":            batch.Title,
+		"AccountKey":       batch.AccountKey,
+		"Amount":           batch.Amount,
+		"TotalSats":        batch.total(),
+		"VouchersIssued":   len(vouchers),
+		"VouchersRedeemed": vouchersRedeemed,
+		"Vouchers":         vouchers,
+	})
+}
+
+func authVoucherBatchPrintHandler(context *gin.Context) {
+	batch := getAccessibleVoucherBatch(context)
+	if batch == nil {
+		return
+	}
+
+	var vouchers []VoucherStatus
+	for _, voucher := range voucherService.getVouchers(batch) {
+		if !voucher.IsRedeemed() {
+			vouchers = append(vouchers, voucher)
+		}
+	}
+
+	context.HTML(http.StatusOK, "voucher-sheet.gohtml", gin.H{
+		"Id":       batch.Id,
+		"Title":    batch.Title,
+		"Amount":   batch.Amount,
+		"Vouchers": vouchers,
+	})
+}
+
+func authVoucherQrCodeHandler(context *gin.Context) {
+	batch := getAccessibleVoucherBatch(context)
+	if batch == nil {
+		return
+	}
+
+	voucher := Voucher(context.Param("k1"))
+	if !slices.Contains(repository.getVouchers(batch), voucher) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	uri := "/ln/withdraw/" + voucher.String()
+	if withdrawalRequest := voucherService.getWithdrawalRequest(voucher.String()); withdrawalRequest != nil {
+		uri = lnWithdrawUri(context, voucher.String(), withdrawalRequest)
+	}
+
+	generateQrCode(context, uri, withdrawScheme, lightningPngData, nil)
+}
+
+func apiAccountAddressCreateHandler(context *gin.Context) {
+	accountKey, account := getAccessibleAccount(context)
+	if accountKey == "" {
+		return
+	}
+	if !account.OnChain.Enabled {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	encoding := getLnUrlEncoding(context, payScheme)
+	if encoding == "" {
+		return
+	}
+
+	scheme, host := getSchemeAndHost(context)
+	lnUrl, err := encodeLnUrl(scheme+"://"+host+"/ln/pay/"+string(accountKey), payScheme, encoding)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding LNURL: %w", err))
+		return
+	}
+
+	address, err := onChainService.createAddress(accountKey, account.OnChain, 0, "")
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating address: %w", err))
+		return
+	}
+
+	pngData, err := encodeUnifiedQrCode(address.address, 0, lnUrl, getAccountThumbnailData(account), qrCodeSize)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding QR code: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusOK, AddressResponse{
+		Address: address.address,
+		QrCode:  pngDataUrl(pngData),
+	})
+}
+
+func apiAccountReceiptPrintHandler(context *gin.Context) {
+	_, account, receipt := getAccessibleAccountReceipt(context)
+	if receipt == nil {
+		return
+	}
+	if account.Receipt.Printer == "" {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	err := printReceipt(account.Receipt.Printer, receipt.escPos(account.Receipt.getColumns()))
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("printing receipt: %w", err))
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func apiAccountShiftOpenHandler(context *gin.Context) {
+	accountKey, _ := getAccessibleAccount(context)
+	if accountKey == "" {
+		return
+	}
+
+	shiftMutex.Lock()
+	defer shiftMutex.Unlock()
+
+	if getOpenShift(accountKey) != nil {
+		abortWithBadRequestResponse(context, "shift already open")
+		return
+	}
+
+	shift := Shift{
+		Opener: getAuthenticatedUser(context),
+		Opened: time.Now(),
+	}
+	err := repository.createAccountShift(accountKey, &shift)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("opening shift: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusCreated, shift)
+}
+
+func apiAccountShiftCloseHandler(context *gin.Context) {
+	shiftMutex.Lock()
+	defer shiftMutex.Unlock()
+
+	accountKey, shift := getAccessibleAccountShift(context)
+	if shift == nil {
+		return
+	}
+	if !shift.IsOpen() {
+		abortWithBadRequestResponse(context, "shift already closed")
+		return
+	}
+
+	shift.Closer = getAuthenticatedUser(context)
+	shift.Closed = time.Now()
+
+	account := config.Accounts[accountKey]
+	report := newZReport(accountKey, account.getCurrency(), shift,
+		repository.getAccountShiftInvoices(accountKey, shift), lndClient.getInvoice, onChainService.getPayments(accountKey),
+		repository.getAccountInvoiceTips(accountKey), repository.getAccountInvoiceItems(accountKey))
+	if err := repository.createAccountShiftReport(accountKey, shift, "csv", report.csv()); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing CSV report: %w", err))
+		return
+	}
+	if err := repository.createAccountShiftReport(accountKey, shift, "pdf", report.pdf()); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing PDF report: %w", err))
+		return
+	}
+
+	err := repository.updateAccountShift(accountKey, shift)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("closing shift: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusOK, shift)
+}
+
+func apiAccountProductCreateHandler(context *gin.Context) {
+	accountKey, _ := getAccessibleAccount(context)
+	if accountKey == "" {
+		return
+	}
+
+	var request ProductRequest
+	if err := context.BindJSON(&request); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	imageData, ok := getProductImageData(context, request.Image)
+	if !ok {
+		return
+	}
+
+	product := request.Product
+	product.HasImage = imageData != nil
+	err := repository.createAccountProduct(accountKey, &product)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating product: %w", err))
+		return
+	}
+
+	if imageData != nil {
+		err := repository.updateAccountProductImage(accountKey, &product, imageData)
+		if err != nil {
+			abortWithInternalServerErrorResponse(context, fmt.Errorf("storing product image: %w", err))
+			return
+		}
+	}
+
+	context.JSON(http.StatusCreated, product)
+}
+
+func apiAccountProductReadHandler(context *gin.Context) {
+	_, product := getAccessibleAccountProduct(context)
+	if product == nil {
+		return
+	}
+
+	context.JSON(http.StatusOK, product)
+}
+
+func apiAccountProductUpdateHandler(context *gin.Context) {
+	accountKey, product := getAccessibleAccountProduct(context)
+	if product == nil {
+		return
+	}
+
+	var request ProductRequest
+	if err := context.BindJSON(&request); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	imageData, ok := getProductImageData(context, request.Image)
+	if !ok {
+		return
+	}
+
+	updatedProduct := request.Product
+	updatedProduct.Id = product.Id
+	updatedProduct.HasImage = product.HasImage
+
+	if request.Image != nil {
+		err := repository.updateAccountProductImage(accountKey, &updatedProduct, imageData)
+		if err != nil {
+			abortWithInternalServerErrorResponse(context, fmt.Errorf("storing product image: %w", err))
+			return
+		}
+		updatedProduct.HasImage = imageData != nil
+	}
+
+	err := repository.updateAccountProduct(accountKey, &updatedProduct)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("updating product: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusOK, updatedProduct)
+}
+
+func apiAccountProductDeleteHandler(context *gin.Context) {
+	accountKey, product := getAccessibleAccountProduct(context)
+	if product == nil {
+		return
+	}
+
+	err := repository.deleteAccountProduct(accountKey, product)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("deleting product: %w", err))
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func apiAccountArchiveHandler(context *gin.Context) {
+	accountKey, account := getAccessibleAccount(context)
+	if accountKey == "" {
+		return
+	}
+	if !account.Archivable {
+		abortWithBadRequestResponse(context, "not archivable")
+		return
+	}
+
+	err := repository.archiveAccountInvoices(accountKey)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("archiving storage file: %w", err))
+		return
+	}
+
+	usersWithAccountAccess := config.Administrators
+	for user, allowedAccounts := range config.AccessControl {
+		if slices.Contains(allowedAccounts, accountKey) {
+			usersWithAccountAccess = append(usersWithAccountAccess, user)
+		}
+	}
+
+	for _, user := range usersWithAccountAccess {
+		userState := repository.getUserState(user)
+		if userState.AccountInvoicesCounts[accountKey] > 0 {
+			userState.AccountInvoicesCounts[accountKey] = 0
+			if err := repository.updateUserState(user, userState); err != nil {
+				log.Println("error updating user state:", err)
+			}
+		}
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func apiAccountWithdrawalCreateHandler(context *gin.Context) {
+	accountKey, account := getAccessibleAccount(context)
+	if accountKey == "" {
+		return
+	}
+	if !account.Withdrawal.isEnabled() {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	var withdrawal AccountWithdrawal
+	if err := context.BindJSON(&withdrawal); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if withdrawal.Amount < int64(account.Withdrawal.MinAmount) || withdrawal.Amount > int64(account.Withdrawal.MaxAmount) {
+		abortWithBadRequestResponse(context, "invalid amount")
+		return
+	}
+
+	authenticatedUser := getAuthenticatedUser(context)
+	withdrawal.Owner = authenticatedUser
+	withdrawal.Target = ""
+	withdrawal.Refund = ""
+	withdrawal.Card = ""
+	withdrawal.Approver = withdrawalApprover(account, authenticatedUser, isAdministrator(context))
+	withdrawal.Canceled = false
+
+	err := accountService.createWithdrawal(accountKey, &withdrawal)
+	if errors.Is(err, errInsufficientBalance) {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating withdrawal: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusCreated, withdrawal)
+}
+
+func apiAccountWithdrawHandler(context *gin.Context) {
+	accountKey, account, withdrawal := getAccessibleAccountWithdrawal(context)
+	if withdrawal == nil {
+		return
+	}
+	if !isUserAuthorized(context, withdrawal.Owner) || !withdrawal.IsWithdrawable() {
+		abortWithBadRequestResponse(context, "not withdrawable")
+		return
+	}
+
+	k1 := accountService.createWithdrawalRequest(accountKey, account, withdrawal)
+
+	generateLnUrl(context, k1, lnWithdrawUri(context, k1, withdrawalService.getRequest(k1)), withdrawScheme)
+}
+
+func apiAccountWithdrawalApproveHandler(context *gin.Context) {
+	if !isAdministrator(context) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	accountKey, _, withdrawal := getAccessibleAccountWithdrawal(context)
+	if withdrawal == nil {
+		return
+	}
+	if withdrawal.IsApproved() || !withdrawal.IsCancelable() {
+		abortWithBadRequestResponse(context, "not approvable")
+		return
+	}
+
+	err := accountService.approveWithdrawal(accountKey, withdrawal, getAuthenticatedUser(context))
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("approving withdrawal: %w", err))
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func apiAccountWithdrawalCancelHandler(context *gin.Context) {
+	accountKey, _, withdrawal := getAccessibleAccountWithdrawal(context)
+	if withdrawal == nil {
+		return
+	}
+	if !isUserAuthorized(context, withdrawal.Owner) || !withdrawal.IsCancelable() {
+		abortWithBadRequestResponse(context, "not cancelable")
+		return
+	}
+
+	err := accountService.cancelWithdrawal(accountKey, withdrawal)
+	if errors.Is(err, errAlreadyWithdrawn) {
+		abortWithBadRequestResponse(context, "not cancelable")
+		return
+	}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("canceling withdrawal: %w", err))
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func apiAccountRefundCreateHandler(context *gin.Context) {
+	accountKey, account := getAccessibleAccount(context)
+	if accountKey == "" {
+		return
+	}
+	if !account.Refundable {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	var request RefundRequest
+	if err := context.BindJSON(&request); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if !slices.Contains(repository.getAllAccountInvoices(accountKey), request.PaymentHash) {
+		abortWithBadRequestResponse(context, "unknown invoice")
+		return
+	}
+	invoice := lndClient.getInvoice(request.PaymentHash)
+	if invoice == nil || !invoice.isSettled() {
+		abortWithBadRequestResponse(context, "invoice not settled")
+		return
+	}
+
+	amount := int64(request.Amount)
+	if request.Fiat {
+		if request.Amount >= 1_000_000 {
+			abortWithBadRequestResponse(context, "invalid amount")
+			return
+		}
+		amount = int64(ratesService.fiatToSats(account.getCurrency(), request.Amount))
+	}
+	if amount < 1 {
+		abortWithBadRequestResponse(context, "invalid amount")
+		return
+	}
+
+	authenticatedUser := getAuthenticatedUser(context)
+	refund := AccountWithdrawal{
+		Owner:    authenticatedUser,
+		Amount:   amount,
+		Approver: withdrawalApprover(account, authenticatedUser, isAdministrator(context)),
+	}
+	err := accountService.createRefund(accountKey, invoice, &refund)
+	if errors.Is(err, errRefundExceeded) || errors.Is(err, errInsufficientBalance) {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating refund: %w", err))
+		return
+	}
+	if !refund.IsApproved() {
+		context.JSON(http.StatusCreated, refund)
+		return
+	}
+
+	k1 := accountService.createWithdrawalRequest(accountKey, account, &refund)
+
+	generateLnUrl(context, k1, lnWithdrawUri(context, k1, withdrawalService.getRequest(k1)), withdrawScheme)
 }
 
 func apiInvoicesHandler(context *gin.Context) {
@@ -854,13 +1848,54 @@ func apiInvoicesHandler(context *gin.Context) {
 		return
 	}
 
+	currency := account.getCurrency()
+	if request.Currency != "" && request.Currency != currency {
+		if !slices.Contains(account.Terminal.Currencies, request.Currency) || len(request.Items) > 0 {
+			abortWithBadRequestResponse(context, "invalid currency")
+			return
+		}
+		currency = request.Currency
+	}
+
+	var items []InvoiceItem
+	if len(request.Items) > 0 {
+		var err error
+		items, err = newInvoiceItems(repository.getAccountProducts(accountKey), request.Items)
+		if err != nil {
+			abortWithBadRequestResponse(context, err.Error())
+			return
+		}
+		request.Amount = strconv.FormatFloat(itemsTotal(items), 'f', -1, 64)
+	}
+
 	amountString, err := strconv.ParseFloat(request.Amount, 32)
-	if err != nil || amountString <= 0 || amountString >= 1_000_000 {
+	if err != nil || amountString <= 0 || amountString >= 1_000_000 ||
+		currency == SAT && amountString != math.Trunc(amountString) {
+		abortWithBadRequestResponse(context, "invalid amount")
+		return
+	}
+
+	if request.Tip != "" && (!slices.Contains(account.Tips, request.Tip) ||
+		!request.Tip.isPercent() && currency != account.getCurrency()) {
+		abortWithBadRequestResponse(context, "invalid tip")
+		return
+	}
+	tipAmount := request.Tip.amount(amountString)
+	if currency == SAT {
+		tipAmount = math.Round(tipAmount)
+	}
+	if amountString+tipAmount >= 1_000_000 {
 		abortWithBadRequestResponse(context, "invalid amount")
 		return
 	}
 
-	amount := msats(ratesService.fiatToSats(account.getCurrency(), amountString))
+	if request.OnChain && !account.OnChain.Enabled {
+		abortWithBadRequestResponse(context, "on-chain payments not enabled")
+		return
+	}
+
+	rate := ratesService.getRate(currency)
+	amount := msats(ratesService.fiatToSats(currency, amountString+tipAmount))
 	invoice := createInvoice(context, amount, "", []byte{})
 	if invoice == nil {
 		return
@@ -869,18 +1904,64 @@ func apiInvoicesHandler(context *gin.Context) {
 		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing invoice: %w", err))
 		return
 	}
+	for i := range items {
+		items[i].paymentHash = invoice.paymentHash
+	}
+	if err := repository.addAccountInvoiceItems(accountKey, items); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing invoice items: %w", err))
+		return
+	}
+	invoiceAmount := InvoiceAmount{invoice.paymentHash, currency, roundFiat(amountString + tipAmount),
+		getAuthenticatedUser(context), rate}
+	if err := repository.addAccountInvoiceAmount(accountKey, invoiceAmount); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing invoice amount: %w", err))
+		return
+	}
+	shiftAmount := ratesService.convert(currency, account.getCurrency(), roundFiat(amountString+tipAmount))
+	shiftInvoice := ShiftInvoice{invoice.paymentHash, shiftAmount, ratesService.getRate(account.getCurrency())}
+	if err := addOpenShiftInvoice(accountKey, shiftInvoice); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing shift invoice: %w", err))
+		return
+	}
+	if len(account.Tips) > 0 {
+		baseAmount := ratesService.convert(currency, account.getCurrency(), roundFiat(amountString))
+		tip := InvoiceTip{invoice.paymentHash, getAuthenticatedUser(context), baseAmount,
+			ratesService.convert(currency, account.getCurrency(), tipAmount)}
+		if err := repository.addAccountInvoiceTip(accountKey, tip); err != nil {
+			abortWithInternalServerErrorResponse(context, fmt.Errorf("storing invoice tip: %w", err))
+			return
+		}
+	}
 
+	var address *OnChainAddress
+	if request.OnChain {
+		address, err = onChainService.createAddress(accountKey, account.OnChain, invoice.amount, invoice.paymentHash)
+		if err != nil {
+			abortWithInternalServerErrorResponse(context, fmt.Errorf("creating address: %w", err))
+			return
+		}
+	}
+
+	var pngData []byte
 	thumbnailData := getAccountThumbnailData(&account)
-	pngData, err := encodeQrCode(strings.ToUpper(invoice.paymentRequest), thumbnailData, qrCodeSize)
+	if address != nil {
+		pngData, err = encodeUnifiedQrCode(address.address, invoice.amount, invoice.paymentRequest, thumbnailData, qrCodeSize)
+	} else {
+		pngData, err = encodeQrCode("lightning:"+strings.ToUpper(invoice.paymentRequest), thumbnailData, qrCodeSize)
+	}
 	if err != nil {
 		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding QR code: %w", err))
 		return
 	}
 
-	context.JSON(http.StatusOK, InvoiceResponse{
+	response := InvoiceResponse{
 		PaymentHash: invoice.paymentHash,
 		QrCode:      pngDataUrl(pngData),
-	})
+	}
+	if address != nil {
+		response.Address = address.address
+	}
+	context.JSON(http.StatusOK, response)
 }
 
 func apiInvoiceStatusHandler(context *gin.Context) {
@@ -891,9 +1972,47 @@ func apiInvoiceStatusHandler(context *gin.Context) {
 		return
 	}
 
-	context.JSON(http.StatusOK, InvoiceStatus{
+	status := InvoiceStatus{
 		Settled: invoice.isSettled(),
-	})
+	}
+	for accountKey := range getAccessibleAccounts(context) {
+		if payment := onChainService.getPayment(accountKey, paymentHash); payment != nil {
+			status.OnChain = payment
+			status.Settled = status.Settled || payment.IsPaid
+			break
+		}
+	}
+
+	context.JSON(http.StatusOK, status)
+}
+
+func apiInvoiceCardPaymentHandler(context *gin.Context) {
+	paymentHash := PaymentHash(context.Param("paymentHash"))
+	if !isInvoiceAccessible(context, paymentHash) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+	invoice := lndClient.getInvoice(paymentHash)
+	if invoice == nil {
+		abortWithNotFoundResponse(context)
+		return
+	}
+	if invoice.isSettled() {
+		abortWithBadRequestResponse(context, "invoice already settled")
+		return
+	}
+
+	var request CardPaymentRequest
+	if err := context.BindJSON(&request); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if err := payWithCard(request.Url, invoice); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+
+	context.Status(http.StatusNoContent)
 }
 
 func apiEventCreateHandler(context *gin.Context) {
@@ -956,6 +2075,7 @@ func apiRaffleCreateHandler(context *gin.Context) {
 		return
 	}
 	raffle.Owner = getAuthenticatedUser(context)
+	raffle.PreimageNumbers = true
 
 	err := repository.createRaffle(&raffle)
 	if err != nil {
@@ -984,125 +2104,312 @@ func apiRaffleUpdateHandler(context *gin.Context) {
 		abortWithBadRequestResponse(context, "not updatable")
 		return
 	}
-
-	var updatedRaffle Raffle
-	if err := context.BindJSON(&updatedRaffle); err != nil {
-		abortWithBadRequestResponse(context, err.Error())
+
+	var updatedRaffle Raffle
+	if err := context.BindJSON(&updatedRaffle); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	updatedRaffle.Id = raffle.Id
+	updatedRaffle.Owner = raffle.Owner
+	updatedRaffle.PreimageNumbers = raffle.PreimageNumbers
+
+	err := repository.updateRaffle(&updatedRaffle)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("updating raffle: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusOK, updatedRaffle)
+}
+
+func apiRaffleDrawCommitHandler(context *gin.Context) {
+	raffle := getAccessibleRaffle(context)
+	if raffle == nil {
+		return
+	}
+	if !repository.isRaffleDrawAvailable(raffle) || repository.isRaffleDrawFinished(raffle) {
+		abortWithBadRequestResponse(context, "not commitable")
+		return
+	}
+
+	var raffleDrawCommit RaffleDrawCommit
+	if err := context.BindJSON(&raffleDrawCommit); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+
+	raffleDraw := repository.getRaffleDraw(raffle)
+	skippedTickets := raffleDrawCommit.SkippedTickets
+	skippedAt := time.Now()
+
+	var raffleSkippedTickets []RaffleSkippedTicket
+	raffleDraw = slices.DeleteFunc(raffleDraw, func(ticket RaffleTicket) bool {
+		if len(skippedTickets) > 0 && skippedTickets[0].Id == ticket.String() {
+			raffleSkippedTickets = append(raffleSkippedTickets, RaffleSkippedTicket{
+				ticket:    ticket,
+				skippedAt: skippedAt,
+				reason:    skippedTickets[0].reason(),
+			})
+			skippedTickets = skippedTickets[1:]
+			return true
+		}
+		return false
+	})
+
+	prizesCount := raffle.PrizesCount()
+	if len(raffleDraw) < prizesCount || len(skippedTickets) > 0 {
+		abortWithBadRequestResponse(context, "invalid commit request")
+		return
+	}
+
+	raffleWinners := raffleDraw[0:prizesCount]
+	slices.Reverse(raffleWinners)
+
+	// skipped tickets get overwritten, so that the commit may be retried if storing winners fails
+	if err := repository.createRaffleSkippedTickets(raffle, raffleSkippedTickets); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing skipped tickets: %w", err))
+		return
+	}
+	if err := repository.createRaffleWinners(raffle, raffleWinners); err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing raffle winners: %w", err))
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func apiRaffleWithdrawHandler(context *gin.Context) {
+	raffle := getAccessibleRaffle(context)
+	if raffle == nil {
+		return
+	}
+	if !repository.isRaffleDrawFinished(raffle) || !isWithdrawable(getRaffleWithdrawal(raffle)) || repository.isRaffleLocked(raffle) {
+		abortWithBadRequestResponse(context, "not withdrawable")
+		return
+	}
+
+	var totalSatsReceived int64
+	for _, tickets := range repository.getRaffleTickets(raffle) {
+		invoice := lndClient.getInvoice(tickets.paymentHash)
+		if invoice != nil && invoice.isSettled() {
+			totalSatsReceived += invoice.amount
+		}
+	}
+
+	k1 := withdrawalService.createRequest(
+		repository.getRaffleWithdrawalFileName(raffle),
+		totalSatsReceived,
+		raffle.Title,
+		"",
+	)
+
+	generateLnUrl(context, k1, lnWithdrawUri(context, k1, withdrawalService.getRequest(k1)), withdrawScheme)
+}
+
+func apiRaffleLockHandler(context *gin.Context) {
+	if !isAdministrator(context) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	raffle := getAccessibleRaffle(context)
+	if raffle == nil {
+		return
+	}
+	if !repository.isRaffleDrawFinished(raffle) || !isWithdrawable(getRaffleWithdrawal(raffle)) {
+		abortWithBadRequestResponse(context, "not lockable")
+		return
+	}
+
+	err := repository.lockRaffle(raffle)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("locking raffle: %w", err))
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+func apiVoucherBatchCreateHandler(context *gin.Context) {
+	var batch VoucherBatch
+	if err := context.BindJSON(&batch); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if _, accountExists := config.Accounts[batch.AccountKey]; !accountExists || !isAccountAccessible(context, batch.AccountKey) {
+		abortWithBadRequestResponse(context, "invalid accountKey")
+		return
+	}
+	batch.Owner = getAuthenticatedUser(context)
+
+	err := voucherService.createBatch(&batch)
+	if errors.Is(err, errInsufficientBalance) {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating vouchers: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusCreated, batch)
+}
+
+func apiCardCreateHandler(context *gin.Context) {
+	if !isAdministrator(context) {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	var card Card
+	if err := context.BindJSON(&card); err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return
+	}
+	if _, accountExists := config.Accounts[card.AccountKey]; !accountExists {
+		abortWithBadRequestResponse(context, "invalid accountKey")
+		return
+	}
+	if card.TapLimit > card.DailyLimit {
+		abortWithBadRequestResponse(context, "tap limit exceeds daily limit")
 		return
 	}
-	updatedRaffle.Id = raffle.Id
-	updatedRaffle.Owner = raffle.Owner
+	card.Owner = getAuthenticatedUser(context)
 
-	err := repository.updateRaffle(&updatedRaffle)
+	err := cardService.createCard(&card)
 	if err != nil {
-		abortWithInternalServerErrorResponse(context, fmt.Errorf("updating raffle: %w", err))
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("creating card: %w", err))
 		return
 	}
 
-	context.JSON(http.StatusOK, updatedRaffle)
+	context.Status(http.StatusCreated)
 }
 
-func apiRaffleDrawCommitHandler(context *gin.Context) {
-	raffle := getAccessibleRaffle(context)
-	if raffle == nil {
+func apiCardEnableHandler(context *gin.Context) {
+	updateCardEnabled(context, true)
+}
+
+func apiCardDisableHandler(context *gin.Context) {
+	updateCardEnabled(context, false)
+}
+
+func updateCardEnabled(context *gin.Context, enabled bool) {
+	card := getAdministeredCard(context)
+	if card == nil {
 		return
 	}
-	if !repository.isRaffleDrawAvailable(raffle) || repository.isRaffleDrawFinished(raffle) {
-		abortWithBadRequestResponse(context, "not commitable")
+
+	err := cardService.setEnabled(card.Id, enabled)
+	if errors.Is(err, errUnknownCard) {
+		abortWithNotFoundResponse(context)
 		return
 	}
-
-	var raffleDrawCommit RaffleDrawCommit
-	if err := context.BindJSON(&raffleDrawCommit); err != nil {
+	if errors.Is(err, errCardWiped) {
 		abortWithBadRequestResponse(context, err.Error())
 		return
 	}
-
-	raffleDraw := repository.getRaffleDraw(raffle)
-	skippedTickets := raffleDrawCommit.SkippedTickets
-	slices.DeleteFunc(raffleDraw, func(ticket RaffleTicket) bool {
-		if slices.Contains(skippedTickets, ticket.String()) {
-			skippedTickets = skippedTickets[1:]
-			return true
-		}
-		return false
-	})
-
-	prizesCount := raffle.PrizesCount()
-	if len(raffleDraw) < prizesCount || len(skippedTickets) > 0 {
-		abortWithBadRequestResponse(context, "invalid commit request")
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("updating card: %w", err))
 		return
 	}
 
-	raffleWinners := raffleDraw[0:prizesCount]
-	slices.Reverse(raffleWinners)
+	context.Status(http.StatusNoContent)
+}
 
-	if err := repository.createRaffleWinners(raffle, raffleWinners); err != nil {
-		abortWithInternalServerErrorResponse(context, fmt.Errorf("storing raffle winners: %w", err))
+func apiCardProgramHandler(context *gin.Context) {
+	card := getAdministeredCard(context)
+	if card == nil {
 		return
 	}
 
-	context.Status(http.StatusNoContent)
-}
-
-func apiRaffleWithdrawHandler(context *gin.Context) {
-	raffle := getAccessibleRaffle(context)
-	if raffle == nil {
+	card, err := cardService.program(card.Id)
+	if errors.Is(err, errUnknownCard) {
+		abortWithNotFoundResponse(context)
 		return
 	}
-	if !repository.isRaffleDrawFinished(raffle) || repository.isRaffleWithdrawalFinished(raffle) || repository.isRaffleLocked(raffle) {
-		abortWithBadRequestResponse(context, "not withdrawable")
+	if errors.Is(err, errCardWiped) {
+		abortWithBadRequestResponse(context, err.Error())
 		return
 	}
-
-	var totalSatsReceived int64
-	for _, tickets := range repository.getRaffleTickets(raffle) {
-		invoice := lndClient.getInvoice(tickets.paymentHash)
-		if invoice != nil && invoice.isSettled() {
-			totalSatsReceived += invoice.amount
-		}
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("updating card: %w", err))
+		return
 	}
 
-	k1 := withdrawalService.createRequest(
-		repository.getRaffleWithdrawalFileName(raffle),
-		totalSatsReceived,
-		raffle.Title,
-	)
-
-	generateLnUrl(context, k1, "/ln/withdraw/"+k1)
+	scheme, host := getSchemeAndHost(context)
+	generateCardQrCode(context, scheme+"://"+host+"/ln/cards/"+string(card.Id)+"/keys?secret="+card.Secret)
 }
 
-func apiRaffleLockHandler(context *gin.Context) {
-	if !isAdministrator(context) {
-		abortWithNotFoundResponse(context)
+func apiCardWipeHandler(context *gin.Context) {
+	card := getAdministeredCard(context)
+	if card == nil {
 		return
 	}
 
-	raffle := getAccessibleRaffle(context)
-	if raffle == nil {
+	card, err := cardService.wipe(card.Id)
+	if errors.Is(err, errUnknownCard) {
+		abortWithNotFoundResponse(context)
 		return
 	}
-	if !repository.isRaffleDrawFinished(raffle) || repository.isRaffleWithdrawalFinished(raffle) {
-		abortWithBadRequestResponse(context, "not lockable")
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("updating card: %w", err))
 		return
 	}
 
-	err := repository.lockRaffle(raffle)
+	wipeRequest, err := json.Marshal(CardWipeRequest{Version: 1, Action: "wipe", Uid: card.Uid, CardKeys: card.Keys})
 	if err != nil {
-		abortWithInternalServerErrorResponse(context, fmt.Errorf("locking raffle: %w", err))
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding wipe request: %w", err))
 		return
 	}
 
-	context.Status(http.StatusNoContent)
+	generateCardQrCode(context, string(wipeRequest))
+}
+
+func generateCardQrCode(context *gin.Context, content string) {
+	pngData, err := encodeQrCode(content, lightningPngData, qrCodeSize)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding QR code: %w", err))
+		return
+	}
+
+	context.JSON(http.StatusOK, CardQrCode{
+		Content: content,
+		QrCode:  pngDataUrl(pngData),
+	})
 }
 
 func lnRaffleTicketUri(raffle *Raffle, quantity int) string {
 	return "/ln/raffle/" + string(raffle.Id) + "?" + quantityParam + "=" + strconv.Itoa(quantity)
 }
 
-func lnRaffleQrCodeUri(raffle *Raffle, quantity int) string {
-	id, q, s := string(raffle.Id), strconv.Itoa(quantity), strconv.Itoa(qrCodeSize)
-	return "/ln/raffle/" + id + "/qr-code?" + quantityParam + "=" + q + "&" + sizeParam + "=" + s
+func lnRaffleQrCodeUri(raffle *Raffle, quantity int, encoding LnUrlEncoding) string {
+	id, q, s, e := string(raffle.Id), strconv.Itoa(quantity), strconv.Itoa(qrCodeSize), string(encoding)
+	return "/ln/raffle/" + id + "/qr-code?" + quantityParam + "=" + q + "&" + sizeParam + "=" + s + "&" + encodingParam + "=" + e
+}
+
+func lnWithdrawUri(context *gin.Context, k1 string, withdrawalRequest *WithdrawalRequest) string {
+	return "/ln/withdraw/" + k1 + "?" + fastWithdrawQuery(lnWithdrawResponse(context, k1, withdrawalRequest))
+}
+
+func lnWithdrawResponse(context *gin.Context, k1 string, withdrawalRequest *WithdrawalRequest) lnurl.LNURLWithdrawResponse {
+	scheme, host := getSchemeAndHost(context)
+	withdrawable := msats(withdrawalRequest.amount)
+
+	var payLink string
+	if _, accountExists := config.Accounts[withdrawalRequest.accountKey]; accountExists {
+		payLink = payScheme + "://" + host + "/ln/pay/" + string(withdrawalRequest.accountKey)
+	}
+
+	return lnurl.LNURLWithdrawResponse{
+		Tag:                withdrawRequestTag,
+		K1:                 k1,
+		Callback:           scheme + "://" + host + "/ln/withdraw",
+		MinWithdrawable:    withdrawable,
+		MaxWithdrawable:    withdrawable,
+		DefaultDescription: withdrawalRequest.description,
+		PayLink:            payLink,
+	}
 }
 
 func getSchemeAndHost(context *gin.Context) (string, string) {
@@ -1164,7 +2471,142 @@ func isAccountAccessible(context *gin.Context, accountKey AccountKey) bool {
 	if slices.Contains(config.Administrators, authenticatedUser) {
 		return true
 	}
-	return slices.Contains(config.AccessControl[authenticatedUser], accountKey)
+	return slices.Contains(config.AccessControl[authenticatedUser], accountKey) ||
+		slices.Contains(config.Operators[authenticatedUser].Accounts, accountKey)
+}
+
+func isInvoiceAccessible(context *gin.Context, paymentHash PaymentHash) bool {
+	for accountKey := range getAccessibleAccounts(context) {
+		if slices.Contains(repository.getAccountInvoices(accountKey), paymentHash) {
+			return true
+		}
+	}
+	return false
+}
+
+func getAccessibleAccountProduct(context *gin.Context) (AccountKey, *Product) {
+	accountKey, _ := getAccessibleAccount(context)
+	if accountKey == "" {
+		return "", nil
+	}
+
+	productId := ProductId(context.Param("id"))
+	if product := repository.getAccountProduct(accountKey, productId); product != nil {
+		return accountKey, product
+	}
+
+	abortWithNotFoundResponse(context)
+	return "", nil
+}
+
+func getAccessibleAccountReceipt(context *gin.Context) (AccountKey, *Account, *Receipt) {
+	accountKey, account := getAccessibleAccount(context)
+	if accountKey == "" {
+		return "", nil, nil
+	}
+
+	paymentHash := PaymentHash(context.Param("paymentHash"))
+	if !slices.Contains(repository.getAllAccountInvoices(accountKey), paymentHash) {
+		abortWithNotFoundResponse(context)
+		return "", nil, nil
+	}
+	invoice := lndClient.getInvoice(paymentHash)
+	if invoice == nil || !invoice.isSettled() {
+		abortWithNotFoundResponse(context)
+		return "", nil, nil
+	}
+
+	receipt := Receipt{
+		merchant:    append([]string{account.Description}, account.Receipt.Header...),
+		currency:    account.getCurrency(),
+		amount:      roundFiat(ratesService.satsToFiat(account.getCurrency(), invoice.amount)),
+		sats:        invoice.amount,
+		paymentHash: paymentHash,
+		settleDate:  invoice.settleDate,
+	}
+	for _, amount := range repository.getAccountInvoiceAmounts(accountKey) {
+		if amount.paymentHash == paymentHash {
+			receipt.currency, receipt.amount, receipt.rate = amount.currency, amount.amount, amount.rate
+		}
+	}
+	for _, item := range repository.getAccountInvoiceItems(accountKey) {
+		if item.paymentHash == paymentHash {
+			receipt.items = append(receipt.items, item)
+		}
+	}
+	for _, tip := range repository.getAccountInvoiceTips(accountKey) {
+		if tip.paymentHash == paymentHash {
+			receipt.tip = tip.tip
+			if receipt.currency != account.getCurrency() && tip.amount+tip.tip > 0 {
+				receipt.tip = roundFiat(receipt.amount * tip.tip / (tip.amount + tip.tip))
+			}
+		}
+	}
+
+	return accountKey, account, &receipt
+}
+
+func getAccessibleAccountShift(context *gin.Context) (AccountKey, *Shift) {
+	accountKey, _ := getAccessibleAccount(context)
+	if accountKey == "" {
+		return "", nil
+	}
+
+	shiftId := ShiftId(context.Param("id"))
+	if shift := repository.getAccountShift(accountKey, shiftId); shift != nil {
+		return accountKey, shift
+	}
+
+	abortWithNotFoundResponse(context)
+	return "", nil
+}
+
+func addOpenShiftInvoice(accountKey AccountKey, shiftInvoice ShiftInvoice) error {
+	shiftMutex.Lock()
+	defer shiftMutex.Unlock()
+
+	if shift := getOpenShift(accountKey); shift != nil {
+		return repository.addAccountShiftInvoice(accountKey, shift, shiftInvoice)
+	}
+	return nil
+}
+
+func getOpenShift(accountKey AccountKey) *Shift {
+	for _, shift := range repository.getAccountShifts(accountKey) {
+		if shift.IsOpen() {
+			return shift
+		}
+	}
+	return nil
+}
+
+func getProductImageData(context *gin.Context, image *string) ([]byte, bool) {
+	if image == nil || *image == "" {
+		return nil, true
+	}
+
+	imageData, err := decodeProductImage(*image)
+	if err != nil {
+		abortWithBadRequestResponse(context, err.Error())
+		return nil, false
+	}
+
+	return imageData, true
+}
+
+func getAccessibleAccountWithdrawal(context *gin.Context) (AccountKey, *Account, *AccountWithdrawal) {
+	accountKey, account := getAccessibleAccount(context)
+	if accountKey == "" {
+		return "", nil, nil
+	}
+
+	withdrawalId := AccountWithdrawalId(context.Param("id"))
+	if withdrawal := accountService.getWithdrawal(accountKey, withdrawalId); withdrawal != nil {
+		return accountKey, account, withdrawal
+	}
+
+	abortWithNotFoundResponse(context)
+	return "", nil, nil
 }
 
 func getAccountThumbnail(account *Account) *Thumbnail {
@@ -1180,6 +2622,23 @@ func getAccountThumbnail(account *Account) *Thumbnail {
 	return thumbnail
 }
 
+func getAccountThumbnails(account *Account) []*Thumbnail {
+	var thumbnails []*Thumbnail
+	for _, fileName := range append([]string{account.Thumbnail}, account.Thumbnails...) {
+		if fileName == "" {
+			continue
+		}
+		thumbnail, err := repository.getThumbnail(fileName)
+		if err != nil {
+			log.Println("error reading thumbnail:", err)
+			continue
+		}
+		thumbnails = append(thumbnails, thumbnail)
+	}
+
+	return thumbnails
+}
+
 func getAccountThumbnailData(account *Account) []byte {
 	if thumbnail := getAccountThumbnail(account); thumbnail != nil {
 		return thumbnail.bytes
@@ -1227,6 +2686,10 @@ func getAccessibleRaffle(context *gin.Context) *Raffle {
 	return nil
 }
 
+func getRaffleWithdrawal(raffle *Raffle) *Withdrawal {
+	return withdrawalService.getWithdrawal(repository.getRaffleWithdrawalFileName(raffle))
+}
+
 func getRaffleThumbnail(raffle *Raffle) *Thumbnail {
 	userThumbnail := config.Thumbnails[raffle.Owner]
 	if userThumbnail == "" {
@@ -1272,6 +2735,51 @@ func getRaffleDraw(context *gin.Context, raffle *Raffle) []RaffleTicket {
 	return raffleDraw
 }
 
+func getVoucherBatch(context *gin.Context) *VoucherBatch {
+	batchId := VoucherBatchId(context.Param("id"))
+	if batch := repository.getVoucherBatch(batchId); batch != nil {
+		return batch
+	}
+
+	abortWithNotFoundResponse(context)
+	return nil
+}
+
+func getAccessibleVoucherBatch(context *gin.Context) *VoucherBatch {
+	batch := getVoucherBatch(context)
+	if batch == nil || isUserAuthorized(context, batch.Owner) {
+		return batch
+	}
+
+	abortWithNotFoundResponse(context)
+	return nil
+}
+
+func getCard(context *gin.Context) *Card {
+	cardId := CardId(context.Param("id"))
+	if card := repository.getCard(cardId); card != nil {
+		return card
+	}
+
+	abortWithNotFoundResponse(context)
+	return nil
+}
+
+func getAdministeredCard(context *gin.Context) *Card {
+	if !isAdministrator(context) {
+		abortWithNotFoundResponse(context)
+		return nil
+	}
+	return getCard(context)
+}
+
+func getWithdrawalRequest(k1 string) *WithdrawalRequest {
+	if withdrawalRequest := withdrawalService.getRequest(k1); withdrawalRequest != nil {
+		return withdrawalRequest
+	}
+	return voucherService.getWithdrawalRequest(k1)
+}
+
 func getRequestedQuantity(context *gin.Context) int {
 	quantityString := context.DefaultQuery(quantityParam, "1")
 	quantity, err := strconv.ParseInt(quantityString, 10, 32)
@@ -1293,6 +2801,11 @@ func isAdministrator(context *gin.Context) bool {
 	return slices.Contains(config.Administrators, authenticatedUser)
 }
 
+func isOperator(context *gin.Context) bool {
+	_, operatorExists := config.Operators[getAuthenticatedUser(context)]
+	return operatorExists
+}
+
 func getAuthenticatedUser(context *gin.Context) UserKey {
 	session := sessions.Default(context)
 	if token := session.Get(sessionTokenKey); token != nil {
@@ -1322,6 +2835,16 @@ func createInvoice(context *gin.Context, msats int64, comment string, descriptio
 	return invoice
 }
 
+func verifyInvoice(context *gin.Context, paymentHash PaymentHash) {
+	invoice := lndClient.getInvoice(paymentHash)
+	if invoice == nil {
+		abortWithNotFoundResponse(context)
+		return
+	}
+
+	context.JSON(http.StatusOK, newLnUrlVerifyResponse(invoice))
+}
+
 func awaitSettlement(zapRequest *nostr.Event, paymentHash PaymentHash) {
 	for i := 0; i < invoiceExpiryInSeconds; i++ {
 		invoice := lndClient.getInvoice(paymentHash)
@@ -1333,15 +2856,33 @@ func awaitSettlement(zapRequest *nostr.Event, paymentHash PaymentHash) {
 	}
 }
 
-func generateLnUrl(context *gin.Context, k1 string, uri string) {
+func getLnUrlEncoding(context *gin.Context, lnUrlScheme string) LnUrlEncoding {
+	encoding := LnUrlEncoding(context.Query(encodingParam))
+	if !encoding.isValid() {
+		abortWithBadRequestResponse(context, "invalid encoding")
+		return ""
+	}
+	if encoding == "" {
+		return config.LnUrlEncoding.get(lnUrlScheme)
+	}
+
+	return encoding
+}
+
+func generateLnUrl(context *gin.Context, k1 string, uri string, lnUrlScheme string) {
+	encoding := getLnUrlEncoding(context, lnUrlScheme)
+	if encoding == "" {
+		return
+	}
+
 	scheme, host := getSchemeAndHost(context)
-	lnUrl, err := lnurl.LNURLEncode(scheme + "://" + host + uri)
+	lnUrl, err := encodeLnUrl(scheme+"://"+host+uri, lnUrlScheme, encoding)
 	if err != nil {
 		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding LNURL: %w", err))
 		return
 	}
 
-	pngData, err := encodeQrCode(lnUrl, lightningPngData, qrCodeSize)
+	pngData, err := encodeQrCode(lnUrlUri(lnUrl), lightningPngData, qrCodeSize)
 	if err != nil {
 		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding QR code: %w", err))
 		return
@@ -1350,13 +2891,19 @@ func generateLnUrl(context *gin.Context, k1 string, uri string) {
 	context.JSON(http.StatusOK, LnUrlData{
 		K1:     k1,
 		LnUrl:  lnUrl,
+		Uri:    lnUrlUri(lnUrl),
 		QrCode: pngDataUrl(pngData),
 	})
 }
 
-func generateQrCode(context *gin.Context, uri string, thumbnailData []byte) {
+func generateQrCode(context *gin.Context, uri string, lnUrlScheme string, thumbnailData []byte, poster *QrCodePoster) {
+	encoding := getLnUrlEncoding(context, lnUrlScheme)
+	if encoding == "" {
+		return
+	}
+
 	scheme, host := getSchemeAndHost(context)
-	lnUrl, err := lnurl.LNURLEncode(scheme + "://" + host + uri)
+	lnUrl, err := encodeLnUrl(scheme+"://"+host+uri, lnUrlScheme, encoding)
 	if err != nil {
 		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding LNURL: %w", err))
 		return
@@ -1369,13 +2916,78 @@ func generateQrCode(context *gin.Context, uri string, thumbnailData []byte) {
 		return
 	}
 
-	pngData, err := encodeQrCode(lnUrl, thumbnailData, int(size))
+	format := QrCodeFormat(context.DefaultQuery(formatParam, string(QrCodeFormatPng)))
+	if !format.isValid() || format.isPoster() && poster == nil {
+		abortWithBadRequestResponse(context, "invalid format")
+		return
+	}
+
+	style := getQrCodeStyle(context)
+	if style == nil {
+		return
+	}
+
+	qrCode, err := newQrCode(lnUrlUri(lnUrl), *style)
+	if err != nil {
+		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding QR code: %w", err))
+		return
+	}
+
+	var data []byte
+	contentType := "application/pdf"
+	switch format {
+	case QrCodeFormatSvg:
+		data, err = qrCode.svg(thumbnailData, int(size))
+		contentType = "image/svg+xml"
+	case QrCodeFormatPdf:
+		data, err = qrCode.pdf(thumbnailData, int(size))
+	case QrCodeFormatA4:
+		data, err = poster.pdf(pdfA4Width, pdfA4Height, qrCode, thumbnailData)
+	case QrCodeFormatA6:
+		data, err = poster.pdf(pdfA6Width, pdfA6Height, qrCode, thumbnailData)
+	default:
+		data, err = qrCode.png(thumbnailData, int(size))
+		contentType = "image/png"
+	}
 	if err != nil {
 		abortWithInternalServerErrorResponse(context, fmt.Errorf("encoding QR code: %w", err))
 		return
 	}
 
-	context.Data(http.StatusOK, "image/png", pngData)
+	context.Data(http.StatusOK, contentType, data)
+}
+
+func getQrCodeStyle(context *gin.Context) *QrCodeStyle {
+	style := defaultQrCodeStyle()
+	var valid bool
+	if level := context.Query(levelParam); level != "" {
+		if style.level, valid = parseQrCodeLevel(level); !valid {
+			abortWithBadRequestResponse(context, "invalid level")
+			return nil
+		}
+	}
+	if border := context.Query(borderParam); border != "" {
+		value, err := strconv.ParseUint(border, 10, 8)
+		if err != nil || value > maxQrCodeBorder {
+			abortWithBadRequestResponse(context, "invalid border")
+			return nil
+		}
+		style.border = int(value)
+	}
+	if foreground := context.Query(colorParam); foreground != "" {
+		if style.foreground, valid = parseHexColor(foreground); !valid {
+			abortWithBadRequestResponse(context, "invalid color")
+			return nil
+		}
+	}
+	if background := context.Query(backgroundParam); background != "" {
+		if style.background, valid = parseHexColor(background); !valid {
+			abortWithBadRequestResponse(context, "invalid background")
+			return nil
+		}
+	}
+
+	return &style
 }
 
 func abortWithNotFoundResponse(context *gin.Context) {
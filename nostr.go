@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip05"
+	"github.com/nbd-wtf/go-nostr/nip19"
 	"log"
 	"os"
+	"strings"
 )
 
 func tagP() []string { return []string{"p", ""} }
@@ -44,6 +47,41 @@ func parseZapRequest(zapRequestJson string, amount string) (*nostr.Event, error)
 	return &zapRequest, nil
 }
 
+func parseNostrPublicKey(value string) (string, error) {
+	if strings.HasPrefix(value, "npub") {
+		prefix, publicKey, err := nip19.Decode(value)
+		if err != nil {
+			return "", err
+		}
+		if prefix != "npub" {
+			return "", errors.New("not a public key")
+		}
+		value = publicKey.(string)
+	}
+	if !nostr.IsValid32ByteHex(value) || !nostr.IsValidPublicKey(value) {
+		return "", errors.New("invalid public key")
+	}
+
+	return value, nil
+}
+
+func wellKnownNostr(accounts map[AccountKey]Account, name string) nip05.WellKnownResponse {
+	response := nip05.WellKnownResponse{Names: map[string]string{}, Relays: map[string][]string{}}
+	for accountKey, account := range accounts {
+		if name != "" && string(accountKey) != name {
+			continue
+		}
+		if publicKey, err := parseNostrPublicKey(account.NostrPubkey); err == nil {
+			response.Names[string(accountKey)] = publicKey
+			if len(account.NostrRelays) > 0 {
+				response.Relays[publicKey] = account.NostrRelays
+			}
+		}
+	}
+
+	return response
+}
+
 type NostrConfig struct {
 	Relays []string
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseNostrPublicKey(t *testing.T) {
+	publicKey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, _ := nip19.EncodePublicKey(publicKey)
+	nsec, _ := nip19.EncodePrivateKey(nostr.GeneratePrivateKey())
+
+	for _, value := range []string{publicKey, npub} {
+		parsedPublicKey, err := parseNostrPublicKey(value)
+		assert.NoError(t, err)
+		assert.Equal(t, publicKey, parsedPublicKey)
+	}
+	for _, value := range []string{"", "npub1", nsec, publicKey[1:], "f" + publicKey[1:] + "x"} {
+		_, err := parseNostrPublicKey(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestWellKnownNostr(t *testing.T) {
+	publicKey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	accounts := map[AccountKey]Account{
+		"satoshi": {NostrPubkey: publicKey, NostrRelays: []string{"wss://nos.lol"}},
+		"hal":     {NostrPubkey: publicKey},
+		"cafe":    {},
+	}
+
+	response := wellKnownNostr(accounts, "satoshi")
+	assert.Equal(t, map[string]string{"satoshi": publicKey}, response.Names)
+	assert.Equal(t, map[string][]string{publicKey: {"wss://nos.lol"}}, response.Relays)
+
+	assert.Len(t, wellKnownNostr(accounts, "").Names, 2)
+	assert.Empty(t, wellKnownNostr(accounts, "cafe").Names)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const onChainReceiptsExpiry = 10 * time.Second
+
+type AccountOnChainConfig struct {
+	Enabled          bool
+	MinConfirmations uint16 `yaml:"min-confirmations"`
+}
+
+func (config *AccountOnChainConfig) getMinConfirmations() int32 {
+	return int32(max(config.MinConfirmations, 1))
+}
+
+type OnChainAddress struct {
+	address          string
+	amount           int64
+	created          time.Time
+	paymentHash      PaymentHash
+	minConfirmations int32
+}
+
+func parseOnChainAddress(value string) OnChainAddress {
+	values := strings.SplitN(value, ",", 5)
+	for len(values) < 5 {
+		values = append(values, "")
+	}
+	amount, _ := strconv.ParseInt(values[1], 10, 64)
+	created, _ := strconv.ParseInt(values[2], 10, 64)
+	minConfirmations, _ := strconv.ParseInt(values[4], 10, 32)
+	return OnChainAddress{values[0], amount, time.Unix(created, 0), PaymentHash(values[3]), int32(max(minConfirmations, 1))}
+}
+
+func (address OnChainAddress) String() string {
+	amount, created := strconv.FormatInt(address.amount, 10), strconv.FormatInt(address.created.Unix(), 10)
+	minConfirmations := strconv.FormatInt(int64(address.minConfirmations), 10)
+	return address.address + "," + amount + "," + created + "," + string(address.paymentHash) + "," + minConfirmations
+}
+
+type OnChainPayment struct {
+	Address       string      `json:"address"`
+	PaymentHash   PaymentHash `json:"-"`
+	Received      int64       `json:"received"`
+	Confirmations int32       `json:"confirmations"`
+	Timestamp     time.Time   `json:"-"`
+	IsConfirmed   bool        `json:"confirmed"`
+	IsPaid        bool        `json:"paid"`
+}
+
+type OnChainService struct {
+	repository *Repository
+	lndClient  *LndClient
+	receipts   *expirable.LRU[string, map[string]OnChainReceipt]
+	mutex      sync.Mutex
+}
+
+func newOnChainService(repository *Repository, lndClient *LndClient) *OnChainService {
+	return &OnChainService{
+		repository: repository,
+		lndClient:  lndClient,
+		receipts:   expirable.NewLRU[string, map[string]OnChainReceipt](1, nil, onChainReceiptsExpiry),
+	}
+}
+
+func (service *OnChainService) createAddress(accountKey AccountKey, config AccountOnChainConfig, amount int64,
+	paymentHash PaymentHash) (*OnChainAddress, error) {
+
+	address, err := service.lndClient.newAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	onChainAddress := OnChainAddress{address, amount, time.Now(), paymentHash, config.getMinConfirmations()}
+	if err := service.repository.addAccountOnChainAddress(accountKey, onChainAddress); err != nil {
+		return nil, err
+	}
+
+	return &onChainAddress, nil
+}
+
+func (service *OnChainService) getPayments(accountKey AccountKey) []OnChainPayment {
+	return service.getPaymentsFor(service.repository.getAccountOnChainAddresses(accountKey))
+}
+
+func (service *OnChainService) getPayment(accountKey AccountKey, paymentHash PaymentHash) *OnChainPayment {
+	for _, address := range service.repository.getAccountOnChainAddresses(accountKey) {
+		if address.paymentHash == paymentHash {
+			payments := service.getPaymentsFor([]OnChainAddress{address})
+			return &payments[0]
+		}
+	}
+
+	return nil
+}
+
+func (service *OnChainService) getPaymentsFor(addresses []OnChainAddress) []OnChainPayment {
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	receipts := service.getReceipts()
+
+	var payments []OnChainPayment
+	for _, address := range addresses {
+		receipt := receipts[address.address]
+		payments = append(payments, OnChainPayment{
+			Address:       address.address,
+			PaymentHash:   address.paymentHash,
+			Received:      receipt.amount,
+			Confirmations: receipt.confirmations,
+			Timestamp:     receipt.timestamp,
+			IsConfirmed:   receipt.amount > 0 && receipt.confirmations >= address.minConfirmations,
+		})
+		payment := &payments[len(payments)-1]
+		payment.IsPaid = payment.IsConfirmed && payment.Received >= address.amount
+	}
+
+	return payments
+}
+
+// getReceipts briefly caches wallet transactions, as terminals poll payment status every few seconds.
+func (service *OnChainService) getReceipts() map[string]OnChainReceipt {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if receipts, cached := service.receipts.Get(""); cached {
+		return receipts
+	}
+
+	receipts, err := service.lndClient.getOnChainReceipts()
+	if err != nil {
+		log.Println("error getting on-chain receipts:", err)
+		return nil
+	}
+	service.receipts.Add("", receipts)
+
+	return receipts
+}
+
+func bip21Uri(address string, amount int64, lightning string) string {
+	var params []string
+	if amount > 0 {
+		params = append(params, "amount="+formatBitcoinAmount(amount))
+	}
+	if strings.Contains(lightning, "://") {
+		params = append(params, "lightning="+url.QueryEscape(lightning))
+	} else if lightning != "" {
+		params = append(params, "lightning="+strings.ToUpper(lightning))
+	}
+
+	uri := "bitcoin:" + strings.ToUpper(address)
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri
+}
+
+func formatBitcoinAmount(sats int64) string {
+	fraction := strings.TrimRight(strconv.FormatInt(satsPerBitcoin+sats%satsPerBitcoin, 10)[1:], "0")
+	if fraction == "" {
+		return strconv.FormatInt(sats/satsPerBitcoin, 10)
+	}
+	return strconv.FormatInt(sats/satsPerBitcoin, 10) + "." + fraction
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestOnChainAddress(t *testing.T) {
+	address := OnChainAddress{
+		address:          "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq",
+		amount:           21_000,
+		created:          time.Unix(1700000000, 0),
+		paymentHash:      "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d",
+		minConfirmations: 3,
+	}
+	assert.Equal(t, address, parseOnChainAddress(address.String()))
+	assert.Equal(t, int32(1), parseOnChainAddress("bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq,0,1700000000,").minConfirmations)
+	assert.Equal(t, int32(1), (&AccountOnChainConfig{Enabled: true}).getMinConfirmations())
+}
+
+func TestBip21Uri(t *testing.T) {
+	address := "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+	assert.Equal(t, "bitcoin:BC1QAR0SRRR7XFKVY5L643LYDNW9RE59GTZZWF5MDQ", bip21Uri(address, 0, ""))
+	assert.Equal(t, "bitcoin:BC1QAR0SRRR7XFKVY5L643LYDNW9RE59GTZZWF5MDQ?amount=0.00021&lightning=LNBC210U1P",
+		bip21Uri(address, 21_000, "lnbc210u1p"))
+	assert.Equal(t, "bitcoin:BC1QAR0SRRR7XFKVY5L643LYDNW9RE59GTZZWF5MDQ?lightning=lnurlp%3A%2F%2Fnakamoto.example%2Fln%2Fpay%2Fsatoshi",
+		bip21Uri(address, 0, "lnurlp://nakamoto.example/ln/pay/satoshi"))
+}
+
+func TestFormatBitcoinAmount(t *testing.T) {
+	assert.Equal(t, "0.00000001", formatBitcoinAmount(1))
+	assert.Equal(t, "0.00021", formatBitcoinAmount(21_000))
+	assert.Equal(t, "1", formatBitcoinAmount(100_000_000))
+	assert.Equal(t, "21.5", formatBitcoinAmount(2_150_000_000))
+}
+
+func TestOnChainServiceWithoutAddresses(t *testing.T) {
+	service := newOnChainService(newRepository("", t.TempDir()+pathSeparator), nil)
+	assert.Nil(t, service.getPayments("satoshi"))
+	assert.Nil(t, service.getPayment("satoshi", "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d"))
+}
+
+func TestOnChainServiceCachedReceipts(t *testing.T) {
+	service := newOnChainService(newRepository("", t.TempDir()+pathSeparator), nil)
+	service.receipts.Add("", map[string]OnChainReceipt{
+		"bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq": {amount: 21_000, confirmations: 2},
+	})
+
+	payments := service.getPaymentsFor([]OnChainAddress{
+		{address: "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq", amount: 21_000, minConfirmations: 1},
+		{address: "bc1qxy2kgdygjrsqtzq2n0yrf2493p83kkfjhx0wlh", amount: 21_000, minConfirmations: 1},
+	})
+	assert.Len(t, payments, 2)
+	assert.True(t, payments[0].IsPaid)
+	assert.Equal(t, int32(2), payments[0].Confirmations)
+	assert.False(t, payments[1].IsConfirmed)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/fiatjaf/go-lnurl"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	PayerDataOptional  PayerDataRequirement = "optional"
+	PayerDataMandatory PayerDataRequirement = "mandatory"
+)
+
+type PayerDataRequirement string
+
+func (requirement PayerDataRequirement) isValid() bool {
+	return requirement == "" || requirement == PayerDataOptional || requirement == PayerDataMandatory
+}
+
+func (requirement PayerDataRequirement) itemSpec() *lnurl.PayerDataItemSpec {
+	if requirement == "" {
+		return nil
+	}
+	return &lnurl.PayerDataItemSpec{Mandatory: requirement == PayerDataMandatory}
+}
+
+func (requirement PayerDataRequirement) accepts(value bool) bool {
+	if requirement == "" {
+		return !value
+	}
+	return value || requirement == PayerDataOptional
+}
+
+type AccountPayerDataConfig struct {
+	Name       PayerDataRequirement
+	Pubkey     PayerDataRequirement
+	Identifier PayerDataRequirement
+	Email      PayerDataRequirement
+	Auth       PayerDataRequirement
+}
+
+func (config *AccountPayerDataConfig) isEnabled() bool {
+	return config.Name != "" || config.Pubkey != "" || config.Identifier != "" || config.Email != "" || config.Auth != ""
+}
+
+func (config *AccountPayerDataConfig) isValid() bool {
+	return config.Name.isValid() && config.Pubkey.isValid() && config.Identifier.isValid() &&
+		config.Email.isValid() && config.Auth.isValid()
+}
+
+type LnUrlPayerDataSpec struct {
+	Name       *lnurl.PayerDataItemSpec    `json:"name,omitempty"`
+	Pubkey     *lnurl.PayerDataItemSpec    `json:"pubkey,omitempty"`
+	Identifier *lnurl.PayerDataItemSpec    `json:"identifier,omitempty"`
+	Email      *lnurl.PayerDataItemSpec    `json:"email,omitempty"`
+	Auth       *lnurl.PayerDataKeyAuthSpec `json:"auth,omitempty"`
+}
+
+type PayerData struct {
+	paymentHash PaymentHash
+	values      lnurl.PayerDataValues
+}
+
+func parsePayerData(value string) PayerData {
+	paymentHash, valuesJson, _ := strings.Cut(value, ",")
+	payerData := PayerData{paymentHash: PaymentHash(paymentHash)}
+	_ = json.Unmarshal([]byte(valuesJson), &payerData.values)
+	return payerData
+}
+
+func (payerData PayerData) String() string {
+	valuesJson, _ := json.Marshal(payerData.values)
+	return string(payerData.paymentHash) + "," + string(valuesJson)
+}
+
+func (payerData PayerData) summary() string {
+	values := payerData.values
+	var items []string
+	for _, item := range []string{values.FreeName, values.LightningAddress, values.Email} {
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	if values.PubKey != "" {
+		items = append(items, Identity(values.PubKey).PublicId())
+	}
+	if values.KeyAuth != nil {
+		items = append(items, Identity(values.KeyAuth.Key).PublicId())
+	}
+	return strings.Join(items, " • ")
+}
+
+type PayerDataService struct {
+	k1s *expirable.LRU[string, AccountKey]
+}
+
+func newPayerDataService() *PayerDataService {
+	return &PayerDataService{
+		k1s: expirable.NewLRU[string, AccountKey](1024, nil, 10*time.Minute),
+	}
+}
+
+func (service *PayerDataService) getSpec(accountKey AccountKey, config AccountPayerDataConfig) *LnUrlPayerDataSpec {
+	if !config.isEnabled() {
+		return nil
+	}
+
+	spec := LnUrlPayerDataSpec{
+		Name:       config.Name.itemSpec(),
+		Pubkey:     config.Pubkey.itemSpec(),
+		Identifier: config.Identifier.itemSpec(),
+		Email:      config.Email.itemSpec(),
+	}
+	if config.Auth != "" {
+		k1 := lnurl.RandomK1()
+		service.k1s.Add(k1, accountKey)
+		spec.Auth = &lnurl.PayerDataKeyAuthSpec{Mandatory: config.Auth == PayerDataMandatory, K1: k1}
+	}
+
+	return &spec
+}
+
+func (service *PayerDataService) parse(accountKey AccountKey, config AccountPayerDataConfig, payerDataJson string) (*lnurl.PayerDataValues, error) {
+	if payerDataJson == "" {
+		payerDataJson = "{}"
+	}
+
+	var values lnurl.PayerDataValues
+	decoder := json.NewDecoder(strings.NewReader(payerDataJson))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	if !config.Name.accepts(values.FreeName != "") || len(values.FreeName) > 100 {
+		return nil, errors.New("invalid name")
+	}
+	if !config.Pubkey.accepts(values.PubKey != "") || values.PubKey != "" && !isPublicKey(values.PubKey) {
+		return nil, errors.New("invalid pubkey")
+	}
+	if !config.Identifier.accepts(values.LightningAddress != "") || values.LightningAddress != "" && !isInternetIdentifier(values.LightningAddress) {
+		return nil, errors.New("invalid identifier")
+	}
+	if !config.Email.accepts(values.Email != "") || values.Email != "" && !isInternetIdentifier(values.Email) {
+		return nil, errors.New("invalid email")
+	}
+	if !config.Auth.accepts(values.KeyAuth != nil) || values.KeyAuth != nil && !service.verifyAuth(accountKey, values.KeyAuth) {
+		return nil, errors.New("invalid auth")
+	}
+
+	return &values, nil
+}
+
+func (service *PayerDataService) verifyAuth(accountKey AccountKey, auth *lnurl.PayerDataKeyAuthValues) bool {
+	if k1AccountKey, k1Valid := service.k1s.Peek(auth.K1); !k1Valid || k1AccountKey != accountKey {
+		return false
+	}
+	if signatureValid, err := lnurl.VerifySignature(auth.K1, auth.Sig, auth.Key); err != nil || !signatureValid {
+		return false
+	}
+
+	service.k1s.Remove(auth.K1)
+	return true
+}
+
+func isPublicKey(value string) bool {
+	publicKey, err := hex.DecodeString(value)
+	return err == nil && len(publicKey) == 33 && (publicKey[0] == 2 || publicKey[0] == 3)
+}
+
+func isInternetIdentifier(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Name == "" && address.Address == value && len(value) <= 320
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/fiatjaf/go-lnurl"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPayerDataRequirement(t *testing.T) {
+	assert.True(t, PayerDataRequirement("").accepts(false))
+	assert.False(t, PayerDataRequirement("").accepts(true))
+	assert.True(t, PayerDataOptional.accepts(false))
+	assert.True(t, PayerDataOptional.accepts(true))
+	assert.False(t, PayerDataMandatory.accepts(false))
+	assert.True(t, PayerDataMandatory.accepts(true))
+	assert.False(t, PayerDataRequirement("required").isValid())
+}
+
+func TestPayerDataService(t *testing.T) {
+	service := newPayerDataService()
+	config := AccountPayerDataConfig{Name: PayerDataOptional, Email: PayerDataMandatory, Auth: PayerDataOptional}
+
+	spec := service.getSpec("satoshi", config)
+	assert.NotNil(t, spec.Name)
+	assert.False(t, spec.Name.Mandatory)
+	assert.True(t, spec.Email.Mandatory)
+	assert.Nil(t, spec.Pubkey)
+	assert.Len(t, spec.Auth.K1, 64)
+	assert.Nil(t, service.getSpec("satoshi", AccountPayerDataConfig{}))
+
+	values, err := service.parse("satoshi", config, `{"name":"Satoshi","email":"satoshi@nakamoto.example"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "Satoshi", values.FreeName)
+
+	invalidPayerData := []string{
+		``,
+		`{"name":"Satoshi"}`,
+		`{"email":"Satoshi <satoshi@nakamoto.example>"}`,
+		`{"email":"satoshi@nakamoto.example","identifier":"satoshi@nakamoto.example"}`,
+		`{"email":"satoshi@nakamoto.example","unknown":true}`,
+		`{"email":"satoshi@nakamoto.example","auth":{"key":"02","k1":"` + spec.Auth.K1 + `","sig":"30"}}`,
+		`{"email":"satoshi@nakamoto.example","auth":{"key":"02","k1":"` + lnurl.RandomK1() + `","sig":"30"}}`,
+	}
+	for _, payerDataJson := range invalidPayerData {
+		_, err := service.parse("satoshi", config, payerDataJson)
+		assert.Error(t, err, payerDataJson)
+	}
+}
+
+func TestPayerData(t *testing.T) {
+	payerData := PayerData{
+		paymentHash: "0f6d4e2bce1b2ae3e8a2ef4e7d28f2a53d8ec6b0cd17ba5a09f7e3dd39a2d2b4",
+		values:      lnurl.PayerDataValues{FreeName: "Satoshi", Email: "satoshi@nakamoto.example"},
+	}
+
+	assert.Equal(t, payerData, parsePayerData(payerData.String()))
+	assert.Equal(t, "Satoshi • satoshi@nakamoto.example", payerData.summary())
+}
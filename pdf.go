@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+const (
+	pdfA4Width      = 595.28
+	pdfA4Height     = 841.89
+	pdfA6Width      = 297.64
+	pdfA6Height     = 419.53
+	pdfCharWidth    = 0.6 // Courier glyph width per point of font size
+	pdfFontsCount   = 2
+	pdfFirstPageRef = 3 + pdfFontsCount
+)
+
+var winAnsiRunes = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+type PdfDocument struct {
+	pages []*PdfPage
+}
+
+type PdfPage struct {
+	width   float64
+	height  float64
+	content bytes.Buffer
+	images  []image.Image
+}
+
+func newPdfDocument() *PdfDocument {
+	return &PdfDocument{}
+}
+
+func (document *PdfDocument) addPage(width float64, height float64) *PdfPage {
+	page := &PdfPage{width: width, height: height}
+	document.pages = append(document.pages, page)
+	return page
+}
+
+func (page *PdfPage) text(x float64, y float64, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&page.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		font, pdfNumber(size), pdfNumber(x), pdfNumber(page.height-y-size), pdfText(text))
+}
+
+func (page *PdfPage) centeredText(y float64, size float64, bold bool, text string) {
+	page.text((page.width-pdfTextWidth(text, size))/2, y, size, bold, text)
+}
+
+func (page *PdfPage) fillColor(red uint8, green uint8, blue uint8) {
+	fmt.Fprintf(&page.content, "%s %s %s rg\n",
+		pdfNumber(float64(red)/255), pdfNumber(float64(green)/255), pdfNumber(float64(blue)/255))
+}
+
+func (page *PdfPage) rectangle(x float64, y float64, width float64, height float64) {
+	fmt.Fprintf(&page.content, "%s %s %s %s re f\n",
+		pdfNumber(x), pdfNumber(page.height-y-height), pdfNumber(width), pdfNumber(height))
+}
+
+func (page *PdfPage) line(x1 float64, y1 float64, x2 float64, y2 float64) {
+	fmt.Fprintf(&page.content, "0.5 w %s %s m %s %s l S\n",
+		pdfNumber(x1), pdfNumber(page.height-y1), pdfNumber(x2), pdfNumber(page.height-y2))
+}
+
+func (page *PdfPage) image(x float64, y float64, width float64, height float64, pageImage image.Image) {
+	fmt.Fprintf(&page.content, "q %s 0 0 %s %s %s cm /Im%d Do Q\n",
+		pdfNumber(width), pdfNumber(height), pdfNumber(x), pdfNumber(page.height-y-height), len(page.images))
+	page.images = append(page.images, pageImage)
+}
+
+func (document *PdfDocument) bytes() []byte {
+	var objects []string
+	var imageObjects []string
+	var pageRefs []string
+	for i := range document.pages {
+		pageRefs = append(pageRefs, strconv.Itoa(pdfFirstPageRef+2*i)+" 0 R")
+	}
+
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids ["+strings.Join(pageRefs, " ")+"] /Count "+strconv.Itoa(len(pageRefs))+" >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+	)
+	imageRef := pdfFirstPageRef + 2*len(document.pages)
+	for i, page := range document.pages {
+		resources := "/Font << /F1 3 0 R /F2 4 0 R >>"
+		if len(page.images) > 0 {
+			resources += " /XObject <<"
+			for j, pageImage := range page.images {
+				resources += fmt.Sprintf(" /Im%d %d 0 R", j, imageRef)
+				imageObjects = append(imageObjects, pdfImage(pageImage))
+				imageRef++
+			}
+			resources += " >>"
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Contents %d 0 R /Resources << %s >> >>",
+				pdfNumber(page.width), pdfNumber(page.height), pdfFirstPageRef+2*i+1, resources),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.content.Len(), page.content.String()),
+		)
+	}
+	objects = append(objects, imageObjects...)
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xrefOffset := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	return pdf.Bytes()
+}
+
+func pdfImage(pageImage image.Image) string {
+	bounds := pageImage.Bounds()
+	var imageData bytes.Buffer
+	writer := zlib.NewWriter(&imageData)
+	row := make([]byte, 3*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			red, green, blue, _ := pageImage.At(x, y).RGBA()
+			i := 3 * (x - bounds.Min.X)
+			row[i], row[i+1], row[i+2] = byte(red>>8), byte(green>>8), byte(blue>>8)
+		}
+		_, _ = writer.Write(row)
+	}
+	_ = writer.Close()
+
+	return fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB "+
+		"/BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+		bounds.Dx(), bounds.Dy(), imageData.Len(), imageData.String())
+}
+
+func pdfNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+func pdfTextWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * pdfCharWidth
+}
+
+func pdfText(text string) string {
+	var encoded strings.Builder
+	for _, character := range winAnsiBytes(text) {
+		switch {
+		case character == '(' || character == ')' || character == '\\':
+			encoded.WriteString(`\` + string(character))
+		case character >= 0x20 && character < 0x7f:
+			encoded.WriteByte(character)
+		default:
+			encoded.WriteString(fmt.Sprintf(`\%03o`, character))
+		}
+	}
+	return encoded.String()
+}
+
+func winAnsiBytes(text string) []byte {
+	var encoded []byte
+	for _, character := range text {
+		switch {
+		case character >= 0x20 && character < 0x7f || character >= 0xa0 && character <= 0xff:
+			encoded = append(encoded, byte(character))
+		case winAnsiRunes[character] != 0:
+			encoded = append(encoded, winAnsiRunes[character])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
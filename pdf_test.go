@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestPdfDocument(t *testing.T) {
+	document := newPdfDocument()
+	page := document.addPage(pdfA6Width, pdfA6Height)
+	page.text(10, 10, 12, true, "Price (incl. tip): 5 €")
+	page.rectangle(10, 30, 20, 20)
+
+	pdfData := string(document.bytes())
+	assert.Contains(t, pdfData, `(Price \(incl. tip\): 5 \200) Tj`)
+	assert.Contains(t, pdfData, "/MediaBox [0 0 297.64 419.53]")
+
+	startXref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(pdfData)
+	assert.NotNil(t, startXref)
+	xrefOffset, _ := strconv.Atoi(startXref[1])
+	assert.Equal(t, "xref\n", pdfData[xrefOffset:xrefOffset+5])
+}
+
+func TestPdfText(t *testing.T) {
+	assert.Equal(t, `Caf\351 \225 \\o/ ?`, pdfText("Café • \\o/ ⚡"))
+}
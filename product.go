@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxProductImageSize = 256 * 1024
+	maxItemQuantity     = 999
+)
+
+var errUnknownProduct = errors.New("unknown product")
+
+type ProductId string
+
+type Product struct {
+	Id       ProductId `json:"id"`
+	Name     string    `json:"name" binding:"min=1,max=50"`
+	Category string    `json:"category" binding:"max=50"`
+	Price    float64   `json:"price" binding:"gt=0,lt=1000000"`
+	HasImage bool      `json:"hasImage"`
+}
+
+type ProductRequest struct {
+	Product
+	Image *string `json:"image"`
+}
+
+type ProductCategory struct {
+	Name     string
+	Products []*Product
+}
+
+type InvoiceRequestItem struct {
+	ProductId ProductId `json:"productId"`
+	Quantity  int       `json:"quantity"`
+}
+
+type InvoiceItem struct {
+	paymentHash PaymentHash
+	productId   ProductId
+	quantity    int
+	price       float64
+	name        string
+}
+
+func parseInvoiceItem(value string) InvoiceItem {
+	values := strings.SplitN(value, ",", 5)
+	for len(values) < 5 {
+		values = append(values, "")
+	}
+	quantity, _ := strconv.Atoi(values[2])
+	price, _ := strconv.ParseFloat(values[3], 64)
+	return InvoiceItem{PaymentHash(values[0]), ProductId(values[1]), quantity, price, values[4]}
+}
+
+func (item InvoiceItem) String() string {
+	quantity, price := strconv.Itoa(item.quantity), strconv.FormatFloat(item.price, 'f', -1, 64)
+	return string(item.paymentHash) + "," + string(item.productId) + "," + quantity + "," + price + "," + item.name
+}
+
+func (item InvoiceItem) total() float64 {
+	return item.price * float64(item.quantity)
+}
+
+type ProductSales struct {
+	Name     string
+	Quantity int
+	Amount   float64
+}
+
+func newInvoiceItems(products []*Product, requestItems []InvoiceRequestItem) ([]InvoiceItem, error) {
+	catalog := map[ProductId]*Product{}
+	for _, product := range products {
+		catalog[product.Id] = product
+	}
+
+	var items []InvoiceItem
+	for _, requestItem := range requestItems {
+		product, exists := catalog[requestItem.ProductId]
+		if !exists {
+			return nil, errUnknownProduct
+		}
+		if requestItem.Quantity < 1 || requestItem.Quantity > maxItemQuantity {
+			return nil, fmt.Errorf("invalid quantity: %d", requestItem.Quantity)
+		}
+		items = append(items, InvoiceItem{"", product.Id, requestItem.Quantity, product.Price, product.Name})
+	}
+
+	return items, nil
+}
+
+func itemsTotal(items []InvoiceItem) float64 {
+	var total float64
+	for _, item := range items {
+		total += item.total()
+	}
+	return roundFiat(total)
+}
+
+func getProductSales(items []InvoiceItem, settled func(PaymentHash) bool) []ProductSales {
+	salesByProduct := map[ProductId]*ProductSales{}
+	for _, item := range items {
+		if !settled(item.paymentHash) {
+			continue
+		}
+		sales, exists := salesByProduct[item.productId]
+		if !exists {
+			sales = &ProductSales{}
+			salesByProduct[item.productId] = sales
+		}
+		sales.Name = item.name
+		sales.Quantity += item.quantity
+		sales.Amount += item.total()
+	}
+
+	var productSales []ProductSales
+	for _, sales := range salesByProduct {
+		productSales = append(productSales, *sales)
+	}
+
+	sort.Slice(productSales, func(i, j int) bool {
+		if productSales[i].Amount == productSales[j].Amount {
+			return productSales[i].Name < productSales[j].Name
+		}
+		return productSales[i].Amount > productSales[j].Amount
+	})
+	return productSales
+}
+
+func getProductCategories(products []*Product) []ProductCategory {
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].Category == products[j].Category {
+			return products[i].Name < products[j].Name
+		}
+		return products[i].Category < products[j].Category
+	})
+
+	var categories []ProductCategory
+	for _, product := range products {
+		if len(categories) == 0 || categories[len(categories)-1].Name != product.Category {
+			categories = append(categories, ProductCategory{Name: product.Category})
+		}
+		category := &categories[len(categories)-1]
+		category.Products = append(category.Products, product)
+	}
+
+	return categories
+}
+
+func decodeProductImage(dataUrl string) ([]byte, error) {
+	_, encodedData, found := strings.Cut(dataUrl, ";base64,")
+	if !found {
+		return nil, errors.New("invalid image data URL")
+	}
+
+	imageData, err := base64.StdEncoding.DecodeString(encodedData)
+	if err != nil {
+		return nil, err
+	}
+	if len(imageData) > maxProductImageSize {
+		return nil, errors.New("image too large")
+	}
+
+	mimeType := http.DetectContentType(imageData)
+	if mimeType != "image/png" && mimeType != "image/jpeg" {
+		return nil, fmt.Errorf("unsupported MIME type: %s", mimeType)
+	}
+
+	return imageData, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInvoiceItem(t *testing.T) {
+	item := InvoiceItem{
+		paymentHash: "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d",
+		productId:   "3vQB7B6MrG",
+		quantity:    2,
+		price:       3.5,
+		name:        "Coffee, large",
+	}
+	assert.Equal(t, item, parseInvoiceItem(item.String()))
+	assert.Equal(t, 7.0, item.total())
+}
+
+func TestNewInvoiceItems(t *testing.T) {
+	products := []*Product{
+		{Id: "coffee", Name: "Coffee", Price: 3.3},
+		{Id: "cake", Name: "Cake", Price: 4.1},
+	}
+
+	items, err := newInvoiceItems(products, []InvoiceRequestItem{{"coffee", 3}, {"cake", 1}})
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Coffee", items[0].name)
+	assert.Equal(t, 14.0, itemsTotal(items))
+
+	_, err = newInvoiceItems(products, []InvoiceRequestItem{{"tea", 1}})
+	assert.ErrorIs(t, err, errUnknownProduct)
+	_, err = newInvoiceItems(products, []InvoiceRequestItem{{"coffee", 0}})
+	assert.Error(t, err)
+	_, err = newInvoiceItems(products, []InvoiceRequestItem{{"coffee", maxItemQuantity + 1}})
+	assert.Error(t, err)
+}
+
+func TestGetProductSales(t *testing.T) {
+	items := []InvoiceItem{
+		{"a", "coffee", 2, 3, "Coffee"},
+		{"a", "cake", 1, 4, "Cake"},
+		{"b", "coffee", 1, 3.5, "Coffee"},
+		{"c", "cake", 5, 4, "Cake"},
+	}
+	sales := getProductSales(items, func(paymentHash PaymentHash) bool {
+		return paymentHash != "c"
+	})
+	assert.Equal(t, []ProductSales{{"Coffee", 3, 9.5}, {"Cake", 1, 4}}, sales)
+}
+
+func TestGetProductCategories(t *testing.T) {
+	products := []*Product{
+		{Id: "tea", Name: "Tea", Category: "Drinks"},
+		{Id: "cake", Name: "Cake", Category: "Food"},
+		{Id: "coffee", Name: "Coffee", Category: "Drinks"},
+	}
+
+	categories := getProductCategories(products)
+	assert.Len(t, categories, 2)
+	assert.Equal(t, "Drinks", categories[0].Name)
+	assert.Equal(t, ProductId("coffee"), categories[0].Products[0].Id)
+	assert.Equal(t, ProductId("tea"), categories[0].Products[1].Id)
+	assert.Equal(t, "Food", categories[1].Name)
+}
+
+func TestDecodeProductImage(t *testing.T) {
+	imageData, err := decodeProductImage("data:image/png;base64," + base64.StdEncoding.EncodeToString(lightningPngData))
+	assert.NoError(t, err)
+	assert.Equal(t, lightningPngData, imageData)
+
+	_, err = decodeProductImage("data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte("coffee")))
+	assert.Error(t, err)
+	_, err = decodeProductImage("coffee")
+	assert.Error(t, err)
+}
+
+func TestAccountProducts(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	product := Product{Name: "Coffee", Category: "Drinks", Price: 3.5}
+	assert.NoError(t, repository.createAccountProduct("satoshi", &product))
+	assert.NotEmpty(t, product.Id)
+	assert.Equal(t, &product, repository.getAccountProduct("satoshi", product.Id))
+
+	assert.NoError(t, repository.updateAccountProductImage("satoshi", &product, lightningPngData))
+	imageData, err := repository.getAccountProductImage("satoshi", &product)
+	assert.NoError(t, err)
+	assert.Equal(t, lightningPngData, imageData)
+	assert.NoError(t, repository.updateAccountProductImage("satoshi", &product, nil))
+
+	assert.Len(t, repository.getAccountProducts("satoshi"), 1)
+	assert.NoError(t, repository.deleteAccountProduct("satoshi", &product))
+	assert.Empty(t, repository.getAccountProducts("satoshi"))
+}
@@ -3,54 +3,345 @@ package main
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"github.com/skip2/go-qrcode"
 	"golang.org/x/image/draw"
 	"image"
+	"image/color"
 	_ "image/jpeg"
 	"image/png"
+	"net/http"
+	"strings"
 )
 
-func encodeQrCode(content string, thumbnailData []byte, size int) ([]byte, error) {
-	qrCode, err := qrcode.New("lightning:"+content, qrcode.Medium)
+const (
+	QrCodeFormatPng QrCodeFormat = "png"
+	QrCodeFormatSvg QrCodeFormat = "svg"
+	QrCodeFormatPdf QrCodeFormat = "pdf"
+	QrCodeFormatA4  QrCodeFormat = "a4"
+	QrCodeFormatA6  QrCodeFormat = "a6"
+)
+
+const (
+	maxQrCodeBorder      = 16
+	posterMarginRatio    = 0.08
+	posterQrCodeRatio    = 0.6
+	posterThumbnailRatio = 0.12
+	posterTitleRatio     = 0.045
+	posterTextRatio      = 0.022
+	posterLineSpacing    = 1.4
+)
+
+type QrCodeFormat string
+
+func (format QrCodeFormat) isValid() bool {
+	switch format {
+	case QrCodeFormatPng, QrCodeFormatSvg, QrCodeFormatPdf, QrCodeFormatA4, QrCodeFormatA6:
+		return true
+	default:
+		return false
+	}
+}
+
+func (format QrCodeFormat) isPoster() bool {
+	return format == QrCodeFormatA4 || format == QrCodeFormatA6
+}
+
+type QrCodeStyle struct {
+	level      qrcode.RecoveryLevel
+	border     int
+	foreground color.RGBA
+	background color.RGBA
+}
+
+func defaultQrCodeStyle() QrCodeStyle {
+	return QrCodeStyle{qrcode.Medium, 0, color.RGBA{A: 0xff}, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}}
+}
+
+func parseQrCodeLevel(value string) (qrcode.RecoveryLevel, bool) {
+	switch strings.ToUpper(value) {
+	case "L":
+		return qrcode.Low, true
+	case "M":
+		return qrcode.Medium, true
+	case "Q":
+		return qrcode.High, true
+	case "H":
+		return qrcode.Highest, true
+	default:
+		return 0, false
+	}
+}
+
+func parseHexColor(value string) (color.RGBA, bool) {
+	rgb, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+	if err != nil || len(rgb) != 3 {
+		return color.RGBA{}, false
+	}
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}, true
+}
+
+func hexColor(rgba color.RGBA) string {
+	return "#" + hex.EncodeToString([]byte{rgba.R, rgba.G, rgba.B})
+}
+
+type QrCode struct {
+	modules [][]bool
+	style   QrCodeStyle
+}
+
+func newQrCode(content string, style QrCodeStyle) (*QrCode, error) {
+	qrCode, err := qrcode.New(content, style.level)
 	if err != nil {
 		return nil, err
 	}
 	qrCode.DisableBorder = true
 
-	thumbnailImage, _, err := image.Decode(bytes.NewReader(thumbnailData))
-	if err != nil {
-		return nil, err
+	bitmap := qrCode.Bitmap()
+	modules := make([][]bool, len(bitmap)+2*style.border)
+	for y := range modules {
+		modules[y] = make([]bool, len(modules))
+		if row := y - style.border; row >= 0 && row < len(bitmap) {
+			copy(modules[y][style.border:], bitmap[row])
+		}
 	}
 
-	qrCodeImage := qrCode.Image(size)
-	qrCodeBounds := qrCodeImage.Bounds()
-	thumbnailBounds := thumbnailImage.Bounds()
+	return &QrCode{modules, style}, nil
+}
+
+func (qrCode *QrCode) hasThumbnail() bool {
+	return qrCode.style.level != qrcode.Low // too little redundancy to cover a fifth of the code
+}
 
-	thumbnailSize := thumbnailBounds.Size()
-	thumbnailDestSize := qrCodeBounds.Size().Div(5)
+func (qrCode *QrCode) thumbnailRect(size float64, thumbnailSize image.Point) (float64, float64, float64, float64) {
+	moduleSize := size / float64(len(qrCode.modules))
+	codeSize := size - 2*float64(qrCode.style.border)*moduleSize
+	width, height := codeSize/5, codeSize/5
 	if thumbnailSize.X < thumbnailSize.Y {
-		thumbnailDestSize.X = thumbnailSize.X * thumbnailDestSize.Y / thumbnailSize.Y
+		width = float64(thumbnailSize.X) * height / float64(thumbnailSize.Y)
 	} else if thumbnailSize.X > thumbnailSize.Y {
-		thumbnailDestSize.Y = thumbnailSize.Y * thumbnailDestSize.X / thumbnailSize.X
+		height = float64(thumbnailSize.Y) * width / float64(thumbnailSize.X)
 	}
+	return (size - width) / 2, (size - height) / 2, width, height
+}
 
-	thumbnailOffset := qrCodeBounds.Size().Sub(thumbnailDestSize).Div(2)
-	thumbnailDestRect := image.Rectangle{Min: thumbnailOffset, Max: thumbnailOffset.Add(thumbnailDestSize)}
+func (qrCode *QrCode) image(size int) *image.RGBA {
+	count := len(qrCode.modules)
+	size = max(size, count)
+	modulesPerPixel := float64(count) / float64(size)
 
-	rgbaImage := image.NewRGBA(qrCodeBounds)
-	draw.Draw(rgbaImage, qrCodeBounds, qrCodeImage, image.Point{}, draw.Over)
-	draw.CatmullRom.Scale(rgbaImage, thumbnailDestRect, thumbnailImage, thumbnailBounds, draw.Over, nil)
+	rgbaImage := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		row := qrCode.modules[int(float64(y)*modulesPerPixel)]
+		for x := 0; x < size; x++ {
+			if row[int(float64(x)*modulesPerPixel)] {
+				rgbaImage.SetRGBA(x, y, qrCode.style.foreground)
+			} else {
+				rgbaImage.SetRGBA(x, y, qrCode.style.background)
+			}
+		}
+	}
+
+	return rgbaImage
+}
+
+func (qrCode *QrCode) png(thumbnailData []byte, size int) ([]byte, error) {
+	rgbaImage := qrCode.image(size)
+	if qrCode.hasThumbnail() {
+		thumbnailImage, _, err := image.Decode(bytes.NewReader(thumbnailData))
+		if err != nil {
+			return nil, err
+		}
+		thumbnailBounds := thumbnailImage.Bounds()
+		x, y, width, height := qrCode.thumbnailRect(float64(rgbaImage.Bounds().Dx()), thumbnailBounds.Size())
+		thumbnailDestRect := image.Rect(int(x), int(y), int(x+width), int(y+height))
+		draw.CatmullRom.Scale(rgbaImage, thumbnailDestRect, thumbnailImage, thumbnailBounds, draw.Over, nil)
+	}
 
 	var qrCodePngData bytes.Buffer
 	pngEncoder := png.Encoder{CompressionLevel: png.BestCompression}
-	err = pngEncoder.Encode(&qrCodePngData, rgbaImage)
-	if err != nil {
+	if err := pngEncoder.Encode(&qrCodePngData, rgbaImage); err != nil {
 		return nil, err
 	}
 
 	return qrCodePngData.Bytes(), nil
 }
 
+func (qrCode *QrCode) svg(thumbnailData []byte, size int) ([]byte, error) {
+	count := len(qrCode.modules)
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`shape-rendering="crispEdges">`+"\n", size, size, count, count)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="%s"/>`+"\n", count, count, hexColor(qrCode.style.background))
+	svg.WriteString(`<path fill="` + hexColor(qrCode.style.foreground) + `" d="`)
+	qrCode.forEachRun(func(x int, y int, length int) {
+		fmt.Fprintf(&svg, "M%d %dh%dv1h-%dz", x, y, length, length)
+	})
+	svg.WriteString(`"/>` + "\n")
+	if qrCode.hasThumbnail() {
+		thumbnailConfig, _, err := image.DecodeConfig(bytes.NewReader(thumbnailData))
+		if err != nil {
+			return nil, err
+		}
+		x, y, width, height := qrCode.thumbnailRect(float64(count), image.Pt(thumbnailConfig.Width, thumbnailConfig.Height))
+		fmt.Fprintf(&svg, `<image x="%g" y="%g" width="%g" height="%g" href="data:%s;base64,%s"/>`+"\n",
+			x, y, width, height, http.DetectContentType(thumbnailData), base64.StdEncoding.EncodeToString(thumbnailData))
+	}
+	svg.WriteString("</svg>\n")
+
+	return svg.Bytes(), nil
+}
+
+func (qrCode *QrCode) pdf(thumbnailData []byte, size int) ([]byte, error) {
+	document := newPdfDocument()
+	page := document.addPage(float64(size), float64(size))
+	if err := qrCode.draw(page, 0, 0, float64(size), thumbnailData); err != nil {
+		return nil, err
+	}
+
+	return document.bytes(), nil
+}
+
+func (qrCode *QrCode) draw(page *PdfPage, x float64, y float64, size float64, thumbnailData []byte) error {
+	moduleSize := size / float64(len(qrCode.modules))
+	background, foreground := qrCode.style.background, qrCode.style.foreground
+
+	page.fillColor(background.R, background.G, background.B)
+	page.rectangle(x, y, size, size)
+	page.fillColor(foreground.R, foreground.G, foreground.B)
+	qrCode.forEachRun(func(moduleX int, moduleY int, length int) {
+		page.rectangle(x+float64(moduleX)*moduleSize, y+float64(moduleY)*moduleSize, float64(length)*moduleSize, moduleSize)
+	})
+	if qrCode.hasThumbnail() {
+		thumbnailImage, _, err := image.Decode(bytes.NewReader(thumbnailData))
+		if err != nil {
+			return err
+		}
+		thumbnailX, thumbnailY, width, height := qrCode.thumbnailRect(size, thumbnailImage.Bounds().Size())
+		page.image(x+thumbnailX, y+thumbnailY, width, height, flattenImage(thumbnailImage, background))
+	}
+
+	return nil
+}
+
+func (qrCode *QrCode) forEachRun(consumer func(x int, y int, length int)) {
+	for y, row := range qrCode.modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			length := 1
+			for x+length < len(row) && row[x+length] {
+				length++
+			}
+			consumer(x, y, length)
+			x += length
+		}
+	}
+}
+
+func flattenImage(sourceImage image.Image, background color.RGBA) *image.RGBA {
+	bounds := sourceImage.Bounds()
+	rgbaImage := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgbaImage, rgbaImage.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(rgbaImage, rgbaImage.Bounds(), sourceImage, bounds.Min, draw.Over)
+	return rgbaImage
+}
+
+type QrCodePoster struct {
+	title       string
+	address     string
+	description []string
+}
+
+func (poster *QrCodePoster) pdf(width float64, height float64, qrCode *QrCode, thumbnailData []byte) ([]byte, error) {
+	thumbnailImage, _, err := image.Decode(bytes.NewReader(thumbnailData))
+	if err != nil {
+		return nil, err
+	}
+
+	document := newPdfDocument()
+	page := document.addPage(width, height)
+	margin := width * posterMarginRatio
+	foreground := qrCode.style.foreground
+	y := margin
+
+	thumbnailSize := thumbnailImage.Bounds().Size()
+	thumbnailHeight := width * posterThumbnailRatio
+	thumbnailWidth := float64(thumbnailSize.X) * thumbnailHeight / float64(thumbnailSize.Y)
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	page.image((width-thumbnailWidth)/2, y, thumbnailWidth, thumbnailHeight, flattenImage(thumbnailImage, white))
+	y += thumbnailHeight + margin/2
+
+	writeLines := func(text string, size float64, bold bool) {
+		for _, line := range wrapText(text, int((width-2*margin)/(size*pdfCharWidth))) {
+			page.centeredText(y, size, bold, line)
+			y += size * posterLineSpacing
+		}
+	}
+
+	page.fillColor(foreground.R, foreground.G, foreground.B)
+	writeLines(poster.title, width*posterTitleRatio, true)
+	y += margin / 2
+
+	qrCodeSize := width * posterQrCodeRatio
+	if err := qrCode.draw(page, (width-qrCodeSize)/2, y, qrCodeSize, thumbnailData); err != nil {
+		return nil, err
+	}
+	y += qrCodeSize + margin/2
+
+	page.fillColor(foreground.R, foreground.G, foreground.B)
+	if poster.address != "" {
+		writeLines(poster.address, width*posterTextRatio*1.25, true)
+		y += margin / 4
+	}
+	for _, paragraph := range poster.description {
+		writeLines(paragraph, width*posterTextRatio, false)
+	}
+	page.centeredText(height-margin, width*posterTextRatio*0.8, false, "Scan with a Lightning wallet")
+
+	return document.bytes(), nil
+}
+
+func wrapText(text string, columns int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > columns {
+			if line != "" {
+				lines, line = append(lines, line), ""
+			}
+			lines, word = append(lines, string([]rune(word)[:columns])), string([]rune(word)[columns:])
+		}
+		if line == "" {
+			line = word
+		} else if len([]rune(line))+1+len([]rune(word)) <= columns {
+			line += " " + word
+		} else {
+			lines, line = append(lines, line), word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func encodeQrCode(content string, thumbnailData []byte, size int) ([]byte, error) {
+	qrCode, err := newQrCode(content, defaultQrCodeStyle())
+	if err != nil {
+		return nil, err
+	}
+
+	return qrCode.png(thumbnailData, size)
+}
+
+func encodeUnifiedQrCode(address string, amount int64, lightning string, thumbnailData []byte, size int) ([]byte, error) {
+	return encodeQrCode(bip21Uri(address, amount, lightning), thumbnailData, size)
+}
+
 func pngDataUrl(pngData []byte) string {
 	return "image/png;base64," + base64.StdEncoding.EncodeToString(pngData)
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestQrCodeFormat(t *testing.T) {
+	assert.True(t, QrCodeFormatSvg.isValid())
+	assert.False(t, QrCodeFormat("jpg").isValid())
+	assert.True(t, QrCodeFormatA6.isPoster())
+	assert.False(t, QrCodeFormatPdf.isPoster())
+}
+
+func TestQrCodeStyle(t *testing.T) {
+	level, valid := parseQrCodeLevel("q")
+	assert.True(t, valid)
+	assert.Equal(t, qrcode.High, level)
+	_, valid = parseQrCodeLevel("X")
+	assert.False(t, valid)
+
+	orange, valid := parseHexColor("#f7931a")
+	assert.True(t, valid)
+	assert.Equal(t, color.RGBA{R: 0xf7, G: 0x93, B: 0x1a, A: 0xff}, orange)
+	assert.Equal(t, "#f7931a", hexColor(orange))
+	_, valid = parseHexColor("f7931")
+	assert.False(t, valid)
+	_, valid = parseHexColor("orange")
+	assert.False(t, valid)
+}
+
+func TestQrCode(t *testing.T) {
+	const content = "lightning:LNURL1DP68GURN8GHJ7MRWW4EXCTNXD9SHG6NPVCHXXMMD9AKXUATJDSKHQCTE8AEK2UMND9HKU0FKVESNZDFEX4SNXENZV4JNWWF3XQMRGVEHXFJKGEFEX5SNXCENVSMNXVECX3JRXC3KXUMXZC3EXSUXXV3HXVEXVCFJ9HYJ2E"
+
+	qrCode, err := newQrCode(content, defaultQrCodeStyle())
+	assert.NoError(t, err)
+	reference, _ := qrcode.New(content, qrcode.Medium)
+	reference.DisableBorder = true
+	referenceImage := reference.Image(256)
+	rgbaImage := qrCode.image(256)
+	assert.Equal(t, referenceImage.Bounds(), rgbaImage.Bounds())
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			referenceRed, _, _, _ := referenceImage.At(x, y).RGBA()
+			red, _, _, _ := rgbaImage.At(x, y).RGBA()
+			if !assert.Equal(t, referenceRed, red, "pixel %d,%d", x, y) {
+				return
+			}
+		}
+	}
+
+	pngData, err := qrCode.png(lightningPngData, 256)
+	assert.NoError(t, err)
+	pngImage, _, err := image.Decode(bytes.NewReader(pngData))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 256), pngImage.Bounds())
+
+	style := QrCodeStyle{qrcode.Low, 4, color.RGBA{R: 0xf7, G: 0x93, B: 0x1a, A: 0xff}, color.RGBA{A: 0xff}}
+	bordered, err := newQrCode(content, style)
+	assert.NoError(t, err)
+	lowReference, _ := qrcode.New(content, qrcode.Low)
+	lowReference.DisableBorder = true
+	assert.Equal(t, len(lowReference.Bitmap())+8, len(bordered.modules))
+	assert.NotContains(t, bordered.modules[3], true)
+	assert.Contains(t, bordered.modules[4], true)
+	assert.False(t, bordered.hasThumbnail())
+	assert.Equal(t, style.background, bordered.image(256).RGBAAt(0, 0))
+
+	svgData, err := bordered.svg(lightningPngData, 256)
+	assert.NoError(t, err)
+	assert.Contains(t, string(svgData), `<path fill="#f7931a" d="M4 4h7v1h-7z`)
+	assert.NotContains(t, string(svgData), "<image")
+	svgData, err = qrCode.svg(lightningPngData, 256)
+	assert.NoError(t, err)
+	assert.Contains(t, string(svgData), `href="data:image/png;base64,`)
+
+	pdfData, err := qrCode.pdf(lightningPngData, 256)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(pdfData), "%PDF-1.4\n"))
+	assert.Contains(t, string(pdfData), "/XObject << /Im0 7 0 R >>")
+	assert.Contains(t, string(pdfData), "/Subtype /Image")
+}
+
+func TestQrCodePoster(t *testing.T) {
+	qrCode, _ := newQrCode("lightning:satoshi@nakamoto.example", defaultQrCodeStyle())
+	poster := QrCodePoster{
+		title:       "Satoshi’s Café",
+		address:     "cafe@nakamoto.example",
+		description: []string{"Coffee & cakes", "Pay with Lightning"},
+	}
+
+	pdfData, err := poster.pdf(pdfA6Width, pdfA6Height, qrCode, lightningPngData)
+	assert.NoError(t, err)
+	assert.Contains(t, string(pdfData), `(Satoshi\222s Caf\351) Tj`)
+	assert.Contains(t, string(pdfData), "(cafe@nakamoto.example) Tj")
+	assert.Contains(t, string(pdfData), "(Pay with Lightning) Tj")
+	assert.Contains(t, string(pdfData), "/Im1 8 0 R")
+}
+
+func TestWrapText(t *testing.T) {
+	assert.Equal(t, []string{"Pay with", "Lightning", "at", "Satoshi’s"}, wrapText("Pay with Lightning at\nSatoshi’s", 9))
+	assert.Equal(t, []string{"lnurl1dp6", "8gurn8ghj", "7 x"}, wrapText("lnurl1dp68gurn8ghj7 x", 9))
+	assert.Nil(t, wrapText(" ", 9))
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"github.com/fiatjaf/go-lnurl"
 	"github.com/mr-tron/base58"
 	"golang.org/x/text/collate"
 	"golang.org/x/text/language"
+	"html/template"
 	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -25,6 +28,9 @@ type Raffle struct {
 	TicketPrice  int           `json:"ticketPrice" binding:"min=1,max=1000000"`
 	FiatCurrency Currency      `json:"fiatCurrency" binding:"required"`
 	Prizes       []RafflePrize `json:"prizes" binding:"min=1,max=21"`
+	// PreimageNumbers is set for raffles created since ticket numbers are derived from the preimage;
+	// tickets of older raffles keep numbers derived from the payment hash.
+	PreimageNumbers bool `json:"preimageNumbers,omitempty"`
 }
 
 func (raffle *Raffle) description(quantity int) string {
@@ -35,8 +41,48 @@ func (raffle *Raffle) sendable(quantity int) int64 {
 	return msats(quantity * raffle.TicketPrice)
 }
 
-func (raffle *Raffle) successMessage(tickets RaffleTickets) string {
-	return raffle.Title + "\n" + tickets.numbers()
+func (raffle *Raffle) poster(quantity int) *QrCodePoster {
+	tickets := strconv.Itoa(quantity) + " ticket"
+	if quantity != 1 {
+		tickets += "s"
+	}
+	var prizes []string
+	for _, prize := range raffle.Prizes {
+		prizes = append(prizes, strconv.Itoa(prize.Quantity)+"× "+prize.Name)
+	}
+
+	return &QrCodePoster{
+		title:       raffle.Title,
+		description: []string{tickets + " for " + strconv.Itoa(quantity*raffle.TicketPrice) + " sats", strings.Join(prizes, ", ")},
+	}
+}
+
+func (raffle *Raffle) ticketSymbols(paymentHash PaymentHash, invoice *Invoice) (string, error) {
+	if !raffle.PreimageNumbers {
+		return raffleTicketSymbols(paymentHash.bytes()), nil
+	}
+	preimage, err := invoice.preimageBytes()
+	if err != nil {
+		return "", err
+	}
+	return raffleTicketSymbols(preimage), nil
+}
+
+func (raffle *Raffle) successMessage(numbers string) string {
+	return raffle.Title + "\n" + numbers
+}
+
+func (raffle *Raffle) successAction(tickets RaffleTickets, invoice *Invoice) (*lnurl.SuccessAction, error) {
+	symbols, err := raffle.ticketSymbols(tickets.paymentHash, invoice)
+	if err != nil {
+		return nil, err
+	}
+	numbers := tickets.numbers(symbols)
+	successAction, err := aesSuccessAction(raffle.Title, numbers, invoice)
+	if err != nil {
+		return successMessage(raffle.successMessage(numbers)), nil
+	}
+	return successAction, nil
 }
 
 func (raffle *Raffle) PrizesCount() int {
@@ -63,8 +109,8 @@ type RafflePrize struct {
 }
 
 type RaffleQrCode struct {
-	LnUrl string
-	Uri   string
+	Link template.URL
+	Uri  string
 }
 
 type RaffleTickets struct {
@@ -81,9 +127,8 @@ func (tickets RaffleTickets) String() string {
 	return string(tickets.paymentHash) + "," + strconv.Itoa(tickets.quantity)
 }
 
-func (tickets RaffleTickets) numbers() string {
+func (tickets RaffleTickets) numbers(symbols string) string {
 	var numbers []string
-	symbols := raffleTicketSymbols(tickets.paymentHash)
 	for i := 0; i < tickets.quantity; i++ {
 		numbers = append(numbers, raffleTicketNumber(symbols, i))
 	}
@@ -107,27 +152,61 @@ func (ticket RaffleTicket) String() string {
 	return string(ticket.paymentHash) + ":" + strconv.Itoa(ticket.index)
 }
 
-func (ticket RaffleTicket) number() string {
-	symbols := raffleTicketSymbols(ticket.paymentHash)
+func (ticket RaffleTicket) number(symbols string) string {
 	return raffleTicketNumber(symbols, ticket.index)
 }
 
-func raffleTicketSymbols(paymentHash PaymentHash) string {
-	return base58.Encode(paymentHash.bytes())
+func raffleTicketSymbols(value []byte) string {
+	return base58.Encode(value)
 }
 
 func raffleTicketNumber(symbols string, index int) string {
 	return symbols[4*index : 4*index+5]
 }
 
+type RaffleSkippedTicket struct {
+	ticket    RaffleTicket
+	skippedAt time.Time
+	reason    string
+}
+
+func parseRaffleSkippedTicket(value string) RaffleSkippedTicket {
+	ticket, rest, _ := strings.Cut(value, ",")
+	skippedAt, reason, _ := strings.Cut(rest, ",")
+	return RaffleSkippedTicket{parseRaffleTicket(ticket), time.Unix(int64(parseInt(skippedAt)), 0), reason}
+}
+
+func (skippedTicket RaffleSkippedTicket) String() string {
+	skippedAt := strconv.FormatInt(skippedTicket.skippedAt.Unix(), 10)
+	return skippedTicket.ticket.String() + "," + skippedAt + "," + skippedTicket.reason
+}
+
 type RaffleDrawTicket struct {
 	Id       string `json:"id"`
 	Number   string `json:"number"`
 	Preimage string `json:"preimage"`
 }
 
+type RaffleDrawSkip struct {
+	Id     string `json:"id" binding:"required"`
+	Reason string `json:"reason" binding:"max=100"`
+}
+
+func (skip RaffleDrawSkip) reason() string {
+	if reason := strings.Join(strings.Fields(skip.Reason), " "); reason != "" {
+		return reason
+	}
+	return "Winner not present"
+}
+
 type RaffleDrawCommit struct {
-	SkippedTickets []string `json:"skippedTickets"`
+	SkippedTickets []RaffleDrawSkip `json:"skippedTickets" binding:"dive"`
+}
+
+type RaffleSkippedDrawTicket struct {
+	RaffleDrawTicket
+	SkippedAt time.Time
+	Reason    string
 }
 
 type RafflePrizeWinners struct {
@@ -144,10 +223,10 @@ func newRaffleService(repository *Repository, lndClient *LndClient) *RaffleServi
 	return &RaffleService{repository: repository, lndClient: lndClient}
 }
 
-func (service *RaffleService) getDrawnTickets(raffleDraw []RaffleTicket) []RaffleDrawTicket {
+func (service *RaffleService) getDrawnTickets(raffle *Raffle, raffleDraw []RaffleTicket) []RaffleDrawTicket {
 	var drawnTickets []RaffleDrawTicket
 	for _, ticket := range raffleDraw {
-		drawnTickets = append(drawnTickets, service.raffleDrawTicket(ticket))
+		drawnTickets = append(drawnTickets, service.raffleDrawTicket(raffle, ticket))
 	}
 
 	return drawnTickets
@@ -163,7 +242,7 @@ func (service *RaffleService) getPrizeWinners(raffle *Raffle) []RafflePrizeWinne
 	for _, prize := range raffle.Prizes {
 		var tickets []RaffleDrawTicket
 		for i := 0; i < prize.Quantity; i++ {
-			tickets = append(tickets, service.raffleDrawTicket(raffleWinners[0]))
+			tickets = append(tickets, service.raffleDrawTicket(raffle, raffleWinners[0]))
 			raffleWinners = raffleWinners[1:]
 		}
 		prizeWinners = append(prizeWinners, RafflePrizeWinners{
@@ -175,11 +254,25 @@ func (service *RaffleService) getPrizeWinners(raffle *Raffle) []RafflePrizeWinne
 	return prizeWinners
 }
 
-func (service *RaffleService) raffleDrawTicket(ticket RaffleTicket) RaffleDrawTicket {
+func (service *RaffleService) getSkippedTickets(raffle *Raffle) []RaffleSkippedDrawTicket {
+	var skippedTickets []RaffleSkippedDrawTicket
+	for _, skippedTicket := range service.repository.getRaffleSkippedTickets(raffle) {
+		skippedTickets = append(skippedTickets, RaffleSkippedDrawTicket{
+			RaffleDrawTicket: service.raffleDrawTicket(raffle, skippedTicket.ticket),
+			SkippedAt:        skippedTicket.skippedAt,
+			Reason:           skippedTicket.reason,
+		})
+	}
+
+	return skippedTickets
+}
+
+func (service *RaffleService) raffleDrawTicket(raffle *Raffle, ticket RaffleTicket) RaffleDrawTicket {
 	invoice := service.lndClient.getInvoice(ticket.paymentHash)
+	symbols, _ := raffle.ticketSymbols(ticket.paymentHash, invoice)
 	return RaffleDrawTicket{
 		Id:       ticket.String(),
-		Number:   ticket.number(),
+		Number:   ticket.number(symbols),
 		Preimage: invoice.preimage[0:5] + "…" + invoice.preimage[59:],
 	}
 }
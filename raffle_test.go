@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/hex"
 	"github.com/stretchr/testify/assert"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestRaffle(t *testing.T) {
@@ -18,9 +20,62 @@ func TestRaffle(t *testing.T) {
 	}
 	assert.Equal(t, "3× Lightning Raffle", raffle.description(3))
 	assert.Equal(t, int64(147000), raffle.sendable(7))
-	assert.Equal(t, "Lightning Raffle\n• FRQEG\n• Gk7zz\n• z758a", raffle.successMessage(tickets))
+	assert.Equal(t, "Lightning Raffle\n• FRQEG\n• Gk7zz\n• z758a", raffle.successMessage(tickets.numbers(raffleTicketSymbols(tickets.paymentHash.bytes()))))
+	successAction, err := raffle.successAction(tickets, &Invoice{})
+	assert.NoError(t, err)
+	assert.Equal(t, successMessage("Lightning Raffle\n• FRQEG\n• Gk7zz\n• z758a"), successAction)
 	assert.Equal(t, 6, raffle.PrizesCount())
 	assert.Equal(t, []string{"Trezor", "Book", "Book", "Stickers", "Stickers", "Stickers"}, raffle.prizes())
+	assert.Equal(t, &QrCodePoster{
+		title:       "Lightning Raffle",
+		description: []string{"3 tickets for 63 sats", "1× Trezor, 2× Book, 3× Stickers"},
+	}, raffle.poster(3))
+}
+
+func TestRaffleSuccessAction(t *testing.T) {
+	raffle := Raffle{Title: "Lightning Raffle"}
+	tickets := RaffleTickets{
+		paymentHash: PaymentHash("d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d"),
+		quantity:    2,
+	}
+	invoice := Invoice{preimage: "3f9b9d4a7c2e8f1b6a5d0c4e3b2a19f8e7d6c5b4a39281706f5e4d3c2b1a0f9e"}
+
+	successAction, err := raffle.successAction(tickets, &invoice)
+	assert.NoError(t, err)
+	assert.Equal(t, "aes", successAction.Tag)
+	assert.Equal(t, "Lightning Raffle", successAction.Description)
+	assert.NotContains(t, successAction.Ciphertext, "FRQEG")
+
+	preimage, _ := hex.DecodeString(invoice.preimage)
+	numbers, err := successAction.Decipher(preimage)
+	assert.NoError(t, err)
+	assert.Equal(t, "• FRQEG\n• Gk7zz", numbers)
+}
+
+func TestRafflePreimageNumbers(t *testing.T) {
+	raffle := Raffle{Title: "Lightning Raffle", PreimageNumbers: true}
+	tickets := RaffleTickets{
+		paymentHash: PaymentHash("d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d"),
+		quantity:    2,
+	}
+	invoice := Invoice{preimage: "3f9b9d4a7c2e8f1b6a5d0c4e3b2a19f8e7d6c5b4a39281706f5e4d3c2b1a0f9e"}
+
+	symbols, err := raffle.ticketSymbols(tickets.paymentHash, &invoice)
+	assert.NoError(t, err)
+	assert.Equal(t, "• 3fwUV\n• 5HJK3", tickets.numbers(symbols))
+	preimage, _ := hex.DecodeString("9c1e5b7a2d4f6083b5e7d9c1a3f5e7092b4d6f8a1c3e5b7d9f0a2c4e6b8d0f13")
+	ticket := RaffleTicket{"a5506d48d2e456769e4f557d440e8e502c815e6670bfb6a4299d136a52db54fd", 9}
+	assert.Equal(t, "gcGRu", ticket.number(raffleTicketSymbols(preimage)))
+
+	successAction, err := raffle.successAction(tickets, &invoice)
+	assert.NoError(t, err)
+	preimage, _ = hex.DecodeString(invoice.preimage)
+	numbers, err := successAction.Decipher(preimage)
+	assert.NoError(t, err)
+	assert.Equal(t, "• 3fwUV\n• 5HJK3", numbers)
+
+	_, err = raffle.successAction(tickets, &Invoice{})
+	assert.Error(t, err)
 }
 
 func TestRaffleTickets(t *testing.T) {
@@ -41,7 +96,7 @@ func TestRaffleTickets(t *testing.T) {
 			assert.Equal(t, paymentHash, tickets.paymentHash)
 			assert.Equal(t, c.expectedQuantity, tickets.quantity)
 			assert.Equal(t, string(paymentHash)+","+strconv.Itoa(c.expectedQuantity), tickets.String())
-			assert.Equal(t, c.expectedNumbers, tickets.numbers())
+			assert.Equal(t, c.expectedNumbers, tickets.numbers(raffleTicketSymbols(paymentHash.bytes())))
 		})
 	}
 }
@@ -64,11 +119,55 @@ func TestRaffleTicket(t *testing.T) {
 			assert.Equal(t, paymentHash, ticket.paymentHash)
 			assert.Equal(t, c.expectedIndex, ticket.index)
 			assert.Equal(t, string(paymentHash)+":"+strconv.Itoa(c.expectedIndex), ticket.String())
-			assert.Equal(t, c.expectedNumber, ticket.number())
+			assert.Equal(t, c.expectedNumber, ticket.number(raffleTicketSymbols(paymentHash.bytes())))
+		})
+	}
+}
+
+func TestRaffleSkippedTicket(t *testing.T) {
+	paymentHash := PaymentHash("a5506d48d2e456769e4f557d440e8e502c815e6670bfb6a4299d136a52db54fd")
+	for _, c := range []struct {
+		testName       string
+		value          string
+		expectedIndex  int
+		expectedTime   int64
+		expectedReason string
+	}{
+		{"no_reason", ":1,1700000000", 1, 1700000000, ""},
+		{"reason", ":9,1700000000,Winner not present", 9, 1700000000, "Winner not present"},
+		{"reason_with_comma", ":0,1700000021,Left early, sadly", 0, 1700000021, "Left early, sadly"},
+	} {
+		t.Run(c.testName, func(t *testing.T) {
+			skippedTicket := parseRaffleSkippedTicket(string(paymentHash) + c.value)
+			assert.Equal(t, RaffleTicket{paymentHash, c.expectedIndex}, skippedTicket.ticket)
+			assert.Equal(t, time.Unix(c.expectedTime, 0), skippedTicket.skippedAt)
+			assert.Equal(t, c.expectedReason, skippedTicket.reason)
+			assert.Equal(t, skippedTicket, parseRaffleSkippedTicket(skippedTicket.String()))
 		})
 	}
 }
 
+func TestRaffleSkippedTicketsRetry(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	raffle := Raffle{Title: "Lightning Raffle"}
+	assert.NoError(t, repository.createRaffle(&raffle))
+
+	ticket := RaffleTicket{"a5506d48d2e456769e4f557d440e8e502c815e6670bfb6a4299d136a52db54fd", 1}
+	skippedTicket := RaffleSkippedTicket{ticket, time.Unix(1700000000, 0), "Winner not present"}
+	assert.NoError(t, repository.createRaffleSkippedTickets(&raffle, []RaffleSkippedTicket{skippedTicket}))
+	assert.NoError(t, repository.createRaffleSkippedTickets(&raffle, []RaffleSkippedTicket{skippedTicket}))
+	assert.Equal(t, []RaffleSkippedTicket{skippedTicket}, repository.getRaffleSkippedTickets(&raffle))
+
+	assert.NoError(t, repository.createRaffleSkippedTickets(&raffle, nil))
+	assert.Empty(t, repository.getRaffleSkippedTickets(&raffle))
+}
+
+func TestRaffleDrawSkip(t *testing.T) {
+	assert.Equal(t, "Winner not present", RaffleDrawSkip{Id: "foo"}.reason())
+	assert.Equal(t, "Winner not present", RaffleDrawSkip{Id: "foo", Reason: " \n "}.reason())
+	assert.Equal(t, "Left early", RaffleDrawSkip{Id: "foo", Reason: " Left\nearly "}.reason())
+}
+
 func TestSortRaffles(t *testing.T) {
 	raffles := []*Raffle{{Title: "Raffle #1"}, {Title: "Raffle #11"}, {Title: "Raffle #2"}}
 	assert.Equal(t, []*Raffle{{Title: "Raffle #1"}, {Title: "Raffle #2"}, {Title: "Raffle #11"}}, sortRaffles(raffles))
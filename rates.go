@@ -21,6 +21,7 @@ const (
 	EUR Currency = "eur"
 	GBP Currency = "gbp"
 	USD Currency = "usd"
+	SAT Currency = "sat"
 )
 
 func supportedCurrencies() []Currency {
@@ -96,16 +97,34 @@ func (service *RatesService) getExchangeRates() map[Currency]float64 {
 	return exchangeRates
 }
 
+func (service *RatesService) getRate(currency Currency) float64 {
+	if currency == SAT {
+		return satsPerBitcoin
+	}
+	return service.rates[currency]
+}
+
+func (service *RatesService) convert(from Currency, to Currency, amount float64) float64 {
+	if from == to {
+		return amount
+	}
+	return roundFiat(amount * service.getRate(to) / service.getRate(from))
+}
+
 func (service *RatesService) fiatToSats(currency Currency, amount float64) uint32 {
-	exchangeRate := service.rates[currency]
+	exchangeRate := service.getRate(currency)
 	sats := math.Round(satsPerBitcoin / exchangeRate * amount)
 
 	return uint32(sats)
 }
 
 func (service *RatesService) satsToFiat(currency Currency, sats int64) float64 {
-	exchangeRate := service.rates[currency]
+	exchangeRate := service.getRate(currency)
 	amount := float64(sats) * exchangeRate / satsPerBitcoin
 
 	return amount
 }
+
+func roundFiat(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
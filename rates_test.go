@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRatesService(t *testing.T) {
+	service := RatesService{rates: map[Currency]float64{EUR: 60_000, USD: 66_000}}
+
+	assert.Equal(t, 60_000.0, service.getRate(EUR))
+	assert.Equal(t, float64(satsPerBitcoin), service.getRate(SAT))
+	assert.Equal(t, uint32(20_000), service.fiatToSats(EUR, 12))
+	assert.Equal(t, uint32(2_100), service.fiatToSats(SAT, 2_100))
+	assert.Equal(t, 13.2, service.satsToFiat(USD, 20_000))
+	assert.Equal(t, 13.2, service.convert(EUR, USD, 12))
+	assert.Equal(t, 12.5, service.convert(EUR, EUR, 12.5))
+	assert.Equal(t, 20_000.0, service.convert(EUR, SAT, 12))
+	assert.Equal(t, 1.2, service.convert(SAT, EUR, 2_000))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	receiptPdfWidth    = 226.77 // 80 mm
+	receiptPdfMargin   = 12.0
+	receiptPdfFontSize = 8.0
+	receiptPdfColumns  = 42
+	defaultColumns     = 48
+	printerTimeout     = 5 * time.Second
+)
+
+var (
+	escPosInitialize  = []byte{0x1b, 0x40}
+	escPosCodePage    = []byte{0x1b, 0x74, 0x10} // WPC1252
+	escPosAlignLeft   = []byte{0x1b, 0x61, 0x00}
+	escPosAlignCenter = []byte{0x1b, 0x61, 0x01}
+	escPosBoldOn      = []byte{0x1b, 0x45, 0x01}
+	escPosBoldOff     = []byte{0x1b, 0x45, 0x00}
+	escPosFeedAndCut  = []byte{0x1b, 0x64, 0x04, 0x1d, 0x56, 0x42, 0x00}
+)
+
+type AccountReceiptConfig struct {
+	Header  []string
+	Printer string
+	Columns uint8
+}
+
+func (config *AccountReceiptConfig) getColumns() int {
+	if config.Columns > 0 {
+		return int(config.Columns)
+	}
+	return defaultColumns
+}
+
+type InvoiceAmount struct {
+	paymentHash PaymentHash
+	currency    Currency
+	amount      float64
+	user        UserKey
+	rate        float64
+}
+
+func parseInvoiceAmount(value string) InvoiceAmount {
+	values := strings.SplitN(value, ",", 5)
+	for len(values) < 5 {
+		values = append(values, "")
+	}
+	amount, _ := strconv.ParseFloat(values[2], 64)
+	rate, _ := strconv.ParseFloat(values[4], 64)
+	return InvoiceAmount{PaymentHash(values[0]), Currency(values[1]), amount, UserKey(values[3]), rate}
+}
+
+func (amount InvoiceAmount) String() string {
+	return string(amount.paymentHash) + "," + string(amount.currency) + "," +
+		strconv.FormatFloat(amount.amount, 'f', -1, 64) + "," + string(amount.user) + "," +
+		strconv.FormatFloat(amount.rate, 'f', -1, 64)
+}
+
+type Receipt struct {
+	merchant    []string
+	items       []InvoiceItem
+	tip         float64
+	currency    Currency
+	amount      float64
+	rate        float64
+	sats        int64
+	paymentHash PaymentHash
+	settleDate  time.Time
+}
+
+type ReceiptLine struct {
+	text     string
+	bold     bool
+	centered bool
+}
+
+func (receipt *Receipt) exchangeRate() float64 {
+	if receipt.rate > 0 {
+		return roundFiat(receipt.rate)
+	}
+	if receipt.sats == 0 {
+		return 0
+	}
+	return roundFiat(receipt.amount * satsPerBitcoin / float64(receipt.sats))
+}
+
+func (receipt *Receipt) lines(columns int) []ReceiptLine {
+	var lines []ReceiptLine
+	for i, merchantLine := range receipt.merchant {
+		lines = append(lines, ReceiptLine{merchantLine, i == 0, true})
+	}
+	lines = append(lines, ReceiptLine{})
+
+	currency := currencyCode(receipt.currency)
+	for _, item := range receipt.items {
+		label := strconv.Itoa(item.quantity) + " x " + item.name
+		lines = append(lines, ReceiptLine{text: reportLine(label, formatFiat(item.total()), columns)})
+	}
+	if receipt.tip > 0 {
+		lines = append(lines, ReceiptLine{text: reportLine("Tip", formatFiat(receipt.tip), columns)})
+	}
+	lines = append(lines,
+		ReceiptLine{text: strings.Repeat("-", columns)},
+		ReceiptLine{text: reportLine("TOTAL "+currency, formatFiat(receipt.amount), columns), bold: true},
+		ReceiptLine{text: reportLine("Paid", strconv.FormatInt(receipt.sats, 10)+" sats", columns)},
+	)
+	if receipt.currency != SAT {
+		lines = append(lines, ReceiptLine{text: reportLine("Rate", formatFiat(receipt.exchangeRate())+" "+currency+"/BTC", columns)})
+	}
+	lines = append(lines,
+		ReceiptLine{text: reportLine("Time", receipt.settleDate.Format("2006-01-02 15:04"), columns)},
+		ReceiptLine{},
+		ReceiptLine{text: "Payment hash:"},
+	)
+	for paymentHash := string(receipt.paymentHash); paymentHash != ""; {
+		length := min(len(paymentHash), columns)
+		lines = append(lines, ReceiptLine{text: paymentHash[:length]})
+		paymentHash = paymentHash[length:]
+	}
+
+	return lines
+}
+
+func (receipt *Receipt) pdf() []byte {
+	const lineHeight = receiptPdfFontSize * 1.4
+
+	lines := receipt.lines(receiptPdfColumns)
+	document := newPdfDocument()
+	page := document.addPage(receiptPdfWidth, 2*receiptPdfMargin+float64(len(lines))*lineHeight)
+	for i, line := range lines {
+		y := receiptPdfMargin + float64(i)*lineHeight
+		if line.centered {
+			page.centeredText(y, receiptPdfFontSize, line.bold, line.text)
+		} else {
+			page.text(receiptPdfMargin, y, receiptPdfFontSize, line.bold, line.text)
+		}
+	}
+
+	return document.bytes()
+}
+
+func (receipt *Receipt) escPos(columns int) []byte {
+	var escPos bytes.Buffer
+	escPos.Write(escPosInitialize)
+	escPos.Write(escPosCodePage)
+	for _, line := range receipt.lines(columns) {
+		if line.centered {
+			escPos.Write(escPosAlignCenter)
+		}
+		if line.bold {
+			escPos.Write(escPosBoldOn)
+		}
+		escPos.Write(winAnsiBytes(line.text))
+		escPos.WriteByte('\n')
+		if line.bold {
+			escPos.Write(escPosBoldOff)
+		}
+		if line.centered {
+			escPos.Write(escPosAlignLeft)
+		}
+	}
+	escPos.Write(escPosFeedAndCut)
+
+	return escPos.Bytes()
+}
+
+func printReceipt(printer string, data []byte) error {
+	connection, err := net.DialTimeout("tcp", printer, printerTimeout)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	if err := connection.SetWriteDeadline(time.Now().Add(printerTimeout)); err != nil {
+		return err
+	}
+	_, err = connection.Write(data)
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReceipt() *Receipt {
+	return &Receipt{
+		merchant:    []string{"Satoshi’s Café", "Main Street 21"},
+		items:       []InvoiceItem{{"d643", "coffee", 2, 3.5, "Coffee"}, {"d643", "cake", 1, 4, "Cheesecake"}},
+		tip:         1,
+		currency:    EUR,
+		amount:      12,
+		sats:        20_000,
+		paymentHash: "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d",
+		settleDate:  time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestInvoiceAmount(t *testing.T) {
+	amount := InvoiceAmount{"d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d", EUR, 12.5, "alice", 61_234.5}
+	assert.Equal(t, amount, parseInvoiceAmount(amount.String()))
+	amount.user, amount.rate = "", 0
+	assert.Equal(t, amount, parseInvoiceAmount("d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d,eur,12.5"))
+}
+
+func TestReceiptLines(t *testing.T) {
+	receipt := testReceipt()
+	assert.Equal(t, 60_000.0, receipt.exchangeRate())
+
+	var texts []string
+	for _, line := range receipt.lines(32) {
+		texts = append(texts, line.text)
+	}
+	assert.Equal(t, []string{
+		"Satoshi’s Café",
+		"Main Street 21",
+		"",
+		"2 x Coffee                  7.00",
+		"1 x Cheesecake              4.00",
+		"Tip                         1.00",
+		"--------------------------------",
+		"TOTAL EUR                  12.00",
+		"Paid                  20000 sats",
+		"Rate            60000.00 EUR/BTC",
+		"Time            2024-05-01 08:30",
+		"",
+		"Payment hash:",
+		"d643d24061a5410f9669397871107181",
+		"9a9700d38b006285246c8e227e32fd4d",
+	}, texts)
+
+	receipt.rate = 61_234.567
+	assert.Equal(t, 61_234.57, receipt.exchangeRate())
+	receipt.currency = SAT
+	assert.NotContains(t, receipt.lines(32), ReceiptLine{text: "Rate            61234.57 SAT/BTC"})
+	assert.Len(t, receipt.lines(32), len(texts)-1)
+}
+
+func TestReceiptPdf(t *testing.T) {
+	pdfData := string(testReceipt().pdf())
+	assert.True(t, strings.HasPrefix(pdfData, "%PDF-1.4\n"))
+	assert.Contains(t, pdfData, `(Satoshi\222s Caf\351) Tj`)
+}
+
+func TestPrintReceipt(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []byte)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer connection.Close()
+		data, _ := io.ReadAll(connection)
+		received <- data
+	}()
+
+	escPos := testReceipt().escPos(defaultColumns)
+	assert.NoError(t, printReceipt(listener.Addr().String(), escPos))
+
+	data := <-received
+	assert.Equal(t, escPos, data)
+	assert.True(t, bytes.HasPrefix(data, append(escPosInitialize, escPosCodePage...)))
+	assert.True(t, bytes.HasSuffix(data, escPosFeedAndCut))
+	assert.Contains(t, string(data), "Satoshi\x92s Caf\xe9\n")
+}
+
+func TestPrintReceiptUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	assert.Error(t, printReceipt(address, []byte{0x1b, 0x40}))
+}
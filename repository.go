@@ -9,7 +9,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,6 +21,8 @@ const (
 	accountsDirName = "accounts" + pathSeparator
 	eventsDirName   = "events" + pathSeparator
 	rafflesDirName  = "raffles" + pathSeparator
+	vouchersDirName = "vouchers" + pathSeparator
+	cardsDirName    = "cards" + pathSeparator
 	jsonExtension   = ".json"
 	csvExtension    = ".csv"
 )
@@ -33,8 +37,9 @@ type UserState struct {
 }
 
 type Repository struct {
-	thumbnailDir string
-	dataDir      string
+	thumbnailDir    string
+	dataDir         string
+	balancesVersion atomic.Int64
 }
 
 func newRepository(thumbnailDir string, dataDir string) *Repository {
@@ -42,6 +47,8 @@ func newRepository(thumbnailDir string, dataDir string) *Repository {
 	_ = createDir(dataDir + accountsDirName)
 	_ = createDir(dataDir + eventsDirName)
 	_ = createDir(dataDir + rafflesDirName)
+	_ = createDir(dataDir + vouchersDirName)
+	_ = createDir(dataDir + cardsDirName)
 
 	return &Repository{
 		thumbnailDir: thumbnailDir,
@@ -49,8 +56,21 @@ func newRepository(thumbnailDir string, dataDir string) *Repository {
 	}
 }
 
+// getBalancesVersion changes whenever ledgers, account withdrawals or voucher batches are written.
+func (repository *Repository) getBalancesVersion() int64 {
+	return repository.balancesVersion.Load()
+}
+
+func (repository *Repository) balancesChanged() {
+	repository.balancesVersion.Add(1)
+}
+
 func (repository *Repository) getThumbnail(fileName string) (*Thumbnail, error) {
-	thumbnailData, err := os.ReadFile(repository.thumbnailDir + fileName)
+	return readThumbnail(repository.thumbnailDir + fileName)
+}
+
+func readThumbnail(fileName string) (*Thumbnail, error) {
+	thumbnailData, err := os.ReadFile(fileName)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +111,20 @@ func (repository *Repository) getAccountInvoices(accountKey AccountKey) []Paymen
 	return readValues(accountInvoicesFileName(repository, accountKey), toPaymentHash)
 }
 
+func (repository *Repository) getAllAccountInvoices(accountKey AccountKey) []PaymentHash {
+	fileNames, err := filepath.Glob(accountInvoicesFileName(repository, accountKey) + "*")
+	if err != nil {
+		log.Println("error listing invoices:", err)
+	}
+
+	var paymentHashes []PaymentHash
+	for _, fileName := range fileNames {
+		paymentHashes = append(paymentHashes, readValues(fileName, toPaymentHash)...)
+	}
+
+	return paymentHashes
+}
+
 func (repository *Repository) getAccountInvoicesCount(accountKey AccountKey) int {
 	if info, err := os.Stat(accountInvoicesFileName(repository, accountKey)); err == nil {
 		return int(info.Size() / 65) // payment hash + line feed
@@ -105,6 +139,291 @@ func (repository *Repository) archiveAccountInvoices(accountKey AccountKey) erro
 	return os.Rename(fileName, archiveFileName)
 }
 
+func (repository *Repository) addAccountPayerData(accountKey AccountKey, payerData PayerData) error {
+	_ = createDir(accountDirName(repository, accountKey))
+	return appendValue(accountPayerDataFileName(repository, accountKey), payerData)
+}
+
+func (repository *Repository) getAccountPayerData(accountKey AccountKey) []PayerData {
+	return readValues(accountPayerDataFileName(repository, accountKey), parsePayerData)
+}
+
+func (repository *Repository) addAccountOnChainAddress(accountKey AccountKey, address OnChainAddress) error {
+	_ = createDir(accountDirName(repository, accountKey))
+	return appendValue(accountOnChainAddressesFileName(repository, accountKey), address)
+}
+
+func (repository *Repository) getAccountOnChainAddresses(accountKey AccountKey) []OnChainAddress {
+	return readValues(accountOnChainAddressesFileName(repository, accountKey), parseOnChainAddress)
+}
+
+func (repository *Repository) addAccountInvoiceItems(accountKey AccountKey, items []InvoiceItem) error {
+	_ = createDir(accountDirName(repository, accountKey))
+	for _, item := range items {
+		if err := appendValue(accountInvoiceItemsFileName(repository, accountKey), item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repository *Repository) getAccountInvoiceItems(accountKey AccountKey) []InvoiceItem {
+	return readValues(accountInvoiceItemsFileName(repository, accountKey), parseInvoiceItem)
+}
+
+func (repository *Repository) addAccountInvoiceAmount(accountKey AccountKey, amount InvoiceAmount) error {
+	_ = createDir(accountDirName(repository, accountKey))
+	return appendValue(accountInvoiceAmountsFileName(repository, accountKey), amount)
+}
+
+func (repository *Repository) getAccountInvoiceAmounts(accountKey AccountKey) []InvoiceAmount {
+	return readValues(accountInvoiceAmountsFileName(repository, accountKey), parseInvoiceAmount)
+}
+
+func (repository *Repository) addAccountInvoiceTip(accountKey AccountKey, tip InvoiceTip) error {
+	_ = createDir(accountDirName(repository, accountKey))
+	return appendValue(accountInvoiceTipsFileName(repository, accountKey), tip)
+}
+
+func (repository *Repository) getAccountInvoiceTips(accountKey AccountKey) []InvoiceTip {
+	return readValues(accountInvoiceTipsFileName(repository, accountKey), parseInvoiceTip)
+}
+
+func (repository *Repository) createAccountShift(accountKey AccountKey, shift *Shift) error {
+	shiftId, err := randomId[ShiftId]()
+	if err != nil {
+		return err
+	}
+
+	_ = createDir(accountDirName(repository, accountKey))
+	_ = createDir(accountShiftsDirName(repository, accountKey))
+	err = createDir(accountShiftDirName(repository, accountKey, shiftId))
+	if err != nil {
+		return err
+	}
+	shift.Id = shiftId
+
+	return writeObject(accountShiftDataFileName(repository, accountKey, shiftId), shift)
+}
+
+func (repository *Repository) getAccountShift(accountKey AccountKey, shiftId ShiftId) *Shift {
+	var shift Shift
+	if err := readObject(accountShiftDataFileName(repository, accountKey, shiftId), &shift); err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("error reading shift:", err)
+		}
+		return nil
+	}
+	shift.Id = shiftId
+
+	return &shift
+}
+
+func (repository *Repository) getAccountShifts(accountKey AccountKey) []*Shift {
+	dirName := accountShiftsDirName(repository, accountKey)
+	if _, err := os.Stat(dirName); os.IsNotExist(err) {
+		return nil
+	}
+
+	var shifts []*Shift
+	for _, dirEntry := range readDirEntries(dirName) {
+		if shift := repository.getAccountShift(accountKey, ShiftId(dirEntry.Name())); shift != nil {
+			shifts = append(shifts, shift)
+		}
+	}
+
+	return shifts
+}
+
+func (repository *Repository) updateAccountShift(accountKey AccountKey, shift *Shift) error {
+	return writeObject(accountShiftDataFileName(repository, accountKey, shift.Id), shift)
+}
+
+func (repository *Repository) addAccountShiftInvoice(accountKey AccountKey, shift *Shift, invoice ShiftInvoice) error {
+	return appendValue(accountShiftInvoicesFileName(repository, accountKey, shift.Id), invoice)
+}
+
+func (repository *Repository) getAccountShiftInvoices(accountKey AccountKey, shift *Shift) []ShiftInvoice {
+	return readValues(accountShiftInvoicesFileName(repository, accountKey, shift.Id), parseShiftInvoice)
+}
+
+func (repository *Repository) createAccountShiftReport(accountKey AccountKey, shift *Shift, format string, data []byte) error {
+	return os.WriteFile(repository.getAccountShiftReportFileName(accountKey, shift, format), data, 0644)
+}
+
+func (repository *Repository) getAccountShiftReportFileName(accountKey AccountKey, shift *Shift, format string) string {
+	return accountShiftReportFileName(repository, accountKey, shift.Id, format)
+}
+
+func (repository *Repository) createAccountProduct(accountKey AccountKey, product *Product) error {
+	productId, err := randomId[ProductId]()
+	if err != nil {
+		return err
+	}
+
+	_ = createDir(accountDirName(repository, accountKey))
+	_ = createDir(accountProductsDirName(repository, accountKey))
+	err = createDir(accountProductDirName(repository, accountKey, productId))
+	if err != nil {
+		return err
+	}
+	product.Id = productId
+
+	return writeObject(accountProductDataFileName(repository, accountKey, productId), product)
+}
+
+func (repository *Repository) getAccountProduct(accountKey AccountKey, productId ProductId) *Product {
+	var product Product
+	if err := readObject(accountProductDataFileName(repository, accountKey, productId), &product); err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("error reading product:", err)
+		}
+		return nil
+	}
+	product.Id = productId
+
+	return &product
+}
+
+func (repository *Repository) getAccountProducts(accountKey AccountKey) []*Product {
+	dirName := accountProductsDirName(repository, accountKey)
+	if _, err := os.Stat(dirName); os.IsNotExist(err) {
+		return nil
+	}
+
+	var products []*Product
+	for _, dirEntry := range readDirEntries(dirName) {
+		if product := repository.getAccountProduct(accountKey, ProductId(dirEntry.Name())); product != nil {
+			products = append(products, product)
+		}
+	}
+
+	return products
+}
+
+func (repository *Repository) updateAccountProduct(accountKey AccountKey, product *Product) error {
+	return writeObject(accountProductDataFileName(repository, accountKey, product.Id), product)
+}
+
+func (repository *Repository) deleteAccountProduct(accountKey AccountKey, product *Product) error {
+	return os.RemoveAll(accountProductDirName(repository, accountKey, product.Id))
+}
+
+func (repository *Repository) getAccountProductImage(accountKey AccountKey, product *Product) ([]byte, error) {
+	return os.ReadFile(accountProductImageFileName(repository, accountKey, product.Id))
+}
+
+func (repository *Repository) updateAccountProductImage(accountKey AccountKey, product *Product, imageData []byte) error {
+	fileName := accountProductImageFileName(repository, accountKey, product.Id)
+	if imageData == nil {
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	return os.WriteFile(fileName, imageData, 0644)
+}
+
+func (repository *Repository) getAccountKeys() []AccountKey {
+	var accountKeys []AccountKey
+	for _, dirEntry := range readDirEntries(repository.dataDir + accountsDirName) {
+		if dirEntry.IsDir() {
+			accountKeys = append(accountKeys, AccountKey(dirEntry.Name()))
+		}
+	}
+
+	return accountKeys
+}
+
+func (repository *Repository) createAccountLedger(accountKey AccountKey, ledger *AccountLedger) error {
+	defer repository.balancesChanged()
+
+	_ = createDir(accountDirName(repository, accountKey))
+	return writeObject(accountLedgerFileName(repository, accountKey), ledger)
+}
+
+func (repository *Repository) getAccountLedger(accountKey AccountKey) *AccountLedger {
+	var ledger AccountLedger
+	if err := readObject(accountLedgerFileName(repository, accountKey), &ledger); err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("error reading ledger:", err)
+		}
+		return nil
+	}
+
+	return &ledger
+}
+
+func (repository *Repository) addAccountLedgerEntry(accountKey AccountKey, entry LedgerEntry) error {
+	defer repository.balancesChanged()
+
+	return appendValue(accountLedgerEntriesFileName(repository, accountKey), entry)
+}
+
+func (repository *Repository) getAccountLedgerEntries(accountKey AccountKey) []LedgerEntry {
+	return readValues(accountLedgerEntriesFileName(repository, accountKey), parseLedgerEntry)
+}
+
+func (repository *Repository) createAccountWithdrawal(accountKey AccountKey, withdrawal *AccountWithdrawal) error {
+	defer repository.balancesChanged()
+
+	withdrawalId, err := randomId[AccountWithdrawalId]()
+	if err != nil {
+		return err
+	}
+
+	_ = createDir(accountDirName(repository, accountKey))
+	_ = createDir(accountWithdrawalsDirName(repository, accountKey))
+	err = createDir(accountWithdrawalDirName(repository, accountKey, withdrawalId))
+	if err != nil {
+		return err
+	}
+	withdrawal.Id = withdrawalId
+
+	return writeObject(accountWithdrawalDataFileName(repository, accountKey, withdrawalId), withdrawal)
+}
+
+func (repository *Repository) getAccountWithdrawal(accountKey AccountKey, withdrawalId AccountWithdrawalId) *AccountWithdrawal {
+	var withdrawal AccountWithdrawal
+	if err := readObject(accountWithdrawalDataFileName(repository, accountKey, withdrawalId), &withdrawal); err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("error reading account withdrawal:", err)
+		}
+		return nil
+	}
+	withdrawal.Id = withdrawalId
+
+	return &withdrawal
+}
+
+func (repository *Repository) getAccountWithdrawals(accountKey AccountKey) []*AccountWithdrawal {
+	dirName := accountWithdrawalsDirName(repository, accountKey)
+	if _, err := os.Stat(dirName); os.IsNotExist(err) {
+		return nil
+	}
+
+	var withdrawals []*AccountWithdrawal
+	for _, dirEntry := range readDirEntries(dirName) {
+		withdrawalId := AccountWithdrawalId(dirEntry.Name())
+		if withdrawal := repository.getAccountWithdrawal(accountKey, withdrawalId); withdrawal != nil {
+			withdrawals = append(withdrawals, withdrawal)
+		}
+	}
+
+	return withdrawals
+}
+
+func (repository *Repository) updateAccountWithdrawal(accountKey AccountKey, withdrawal *AccountWithdrawal) error {
+	defer repository.balancesChanged()
+
+	return writeObject(accountWithdrawalDataFileName(repository, accountKey, withdrawal.Id), withdrawal)
+}
+
+func (repository *Repository) getAccountWithdrawalFileName(accountKey AccountKey, withdrawal *AccountWithdrawal) string {
+	return accountWithdrawalFileName(repository, accountKey, withdrawal.Id)
+}
+
 func (repository *Repository) createEvent(event *Event) error {
 	eventId, err := randomId[EventId]()
 	if err != nil {
@@ -229,9 +548,12 @@ func (repository *Repository) getRaffleWinners(raffle *Raffle) []RaffleTicket {
 	return readValues(raffleWinnersFileName(repository, raffle.Id), parseRaffleTicket)
 }
 
-func (repository *Repository) isRaffleWithdrawalFinished(raffle *Raffle) bool {
-	_, err := os.Stat(raffleWithdrawalFileName(repository, raffle.Id))
-	return err == nil
+func (repository *Repository) createRaffleSkippedTickets(raffle *Raffle, skippedTickets []RaffleSkippedTicket) error {
+	return replaceValues(raffleSkippedTicketsFileName(repository, raffle.Id), skippedTickets)
+}
+
+func (repository *Repository) getRaffleSkippedTickets(raffle *Raffle) []RaffleSkippedTicket {
+	return readValues(raffleSkippedTicketsFileName(repository, raffle.Id), parseRaffleSkippedTicket)
 }
 
 func (repository *Repository) getRaffleWithdrawalFileName(raffle *Raffle) string {
@@ -254,8 +576,143 @@ func (repository *Repository) lockRaffle(raffle *Raffle) error {
 	return nil
 }
 
-func (repository *Repository) createWithdrawal(request *WithdrawalRequest, paymentHash PaymentHash) error {
-	return writeValues(request.fileName, []PaymentHash{paymentHash})
+func (repository *Repository) getWithdrawal(fileName string) *Withdrawal {
+	var withdrawal Withdrawal
+	if err := readObject(fileName, &withdrawal); err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("error reading withdrawal:", err)
+			return nil
+		}
+		return getLegacyWithdrawal(fileName)
+	}
+
+	return &withdrawal
+}
+
+// getLegacyWithdrawal reads withdrawals stored as CSV files holding just the payment hash;
+// these were only written once the payment succeeded.
+func getLegacyWithdrawal(fileName string) *Withdrawal {
+	legacyFileName := strings.TrimSuffix(fileName, jsonExtension) + csvExtension
+	fileInfo, err := os.Stat(legacyFileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("error reading legacy withdrawal:", err)
+		}
+		return nil
+	}
+
+	var paymentHash PaymentHash
+	if paymentHashes := readValues(legacyFileName, toPaymentHash); len(paymentHashes) > 0 {
+		paymentHash = paymentHashes[0]
+	}
+	return &Withdrawal{
+		PaymentHash: paymentHash,
+		State:       WithdrawalSucceeded,
+		Created:     fileInfo.ModTime(),
+		Updated:     fileInfo.ModTime(),
+	}
+}
+
+func (repository *Repository) updateWithdrawal(fileName string, withdrawal *Withdrawal) error {
+	return writeObject(fileName, withdrawal)
+}
+
+func (repository *Repository) createVoucherBatch(batch *VoucherBatch, vouchers []Voucher) error {
+	defer repository.balancesChanged()
+
+	batchId, err := randomId[VoucherBatchId]()
+	if err != nil {
+		return err
+	}
+
+	err = createDir(voucherBatchDirName(repository, batchId))
+	if err != nil {
+		return err
+	}
+	err = createDir(voucherWithdrawalsDirName(repository, batchId))
+	if err != nil {
+		return err
+	}
+	batch.Id = batchId
+
+	if err := writeValues(voucherBatchVouchersFileName(repository, batchId), vouchers); err != nil {
+		return err
+	}
+
+	return writeObject(voucherBatchDataFileName(repository, batchId), batch)
+}
+
+func (repository *Repository) getVoucherBatch(batchId VoucherBatchId) *VoucherBatch {
+	var batch VoucherBatch
+	if err := readObject(voucherBatchDataFileName(repository, batchId), &batch); err != nil {
+		log.Println("error reading voucher batch:", err)
+		return nil
+	}
+	batch.Id = batchId
+
+	return &batch
+}
+
+func (repository *Repository) getVoucherBatches() []*VoucherBatch {
+	var batches []*VoucherBatch
+	for _, dirEntry := range readDirEntries(repository.dataDir + vouchersDirName) {
+		if batch := repository.getVoucherBatch(VoucherBatchId(dirEntry.Name())); batch != nil {
+			batches = append(batches, batch)
+		}
+	}
+
+	return batches
+}
+
+func (repository *Repository) getVouchers(batch *VoucherBatch) []Voucher {
+	return readValues(voucherBatchVouchersFileName(repository, batch.Id), toVoucher)
+}
+
+func (repository *Repository) getVoucherWithdrawalFileName(batch *VoucherBatch, voucher Voucher) string {
+	return voucherWithdrawalFileName(repository, batch.Id, voucher)
+}
+
+func (repository *Repository) createCard(card *Card) error {
+	cardId, err := randomId[CardId]()
+	if err != nil {
+		return err
+	}
+
+	err = createDir(cardDirName(repository, cardId))
+	if err != nil {
+		return err
+	}
+	card.Id = cardId
+
+	return writeObject(cardDataFileName(repository, cardId), card)
+}
+
+func (repository *Repository) getCard(cardId CardId) *Card {
+	var card Card
+	if err := readObject(cardDataFileName(repository, cardId), &card); err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("error reading card:", err)
+		}
+		return nil
+	}
+	card.Id = cardId
+
+	return &card
+}
+
+func (repository *Repository) getCards() []*Card {
+	var cards []*Card
+	for _, dirEntry := range readDirEntries(repository.dataDir + cardsDirName) {
+		if card := repository.getCard(CardId(dirEntry.Name())); card != nil {
+			cards = append(cards, card)
+		}
+	}
+
+	return cards
+}
+
+func (repository *Repository) updateCard(card *Card) error {
+	return writeObject(cardDataFileName(repository, card.Id), card)
 }
 
 func userDirName(repository *Repository, user UserKey) string {
@@ -274,6 +731,86 @@ func accountInvoicesFileName(repository *Repository, accountKey AccountKey) stri
 	return accountDirName(repository, accountKey) + "invoices" + csvExtension
 }
 
+func accountOnChainAddressesFileName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "addresses" + csvExtension
+}
+
+func accountPayerDataFileName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "payers" + csvExtension
+}
+
+func accountInvoiceItemsFileName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "items" + csvExtension
+}
+
+func accountInvoiceAmountsFileName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "amounts" + csvExtension
+}
+
+func accountInvoiceTipsFileName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "tips" + csvExtension
+}
+
+func accountShiftsDirName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "shifts" + pathSeparator
+}
+
+func accountShiftDirName(repository *Repository, accountKey AccountKey, shiftId ShiftId) string {
+	return accountShiftsDirName(repository, accountKey) + string(shiftId) + pathSeparator
+}
+
+func accountShiftDataFileName(repository *Repository, accountKey AccountKey, shiftId ShiftId) string {
+	return accountShiftDirName(repository, accountKey, shiftId) + "data" + jsonExtension
+}
+
+func accountShiftInvoicesFileName(repository *Repository, accountKey AccountKey, shiftId ShiftId) string {
+	return accountShiftDirName(repository, accountKey, shiftId) + "invoices" + csvExtension
+}
+
+func accountShiftReportFileName(repository *Repository, accountKey AccountKey, shiftId ShiftId, format string) string {
+	return accountShiftDirName(repository, accountKey, shiftId) + "report." + format
+}
+
+func accountProductsDirName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "products" + pathSeparator
+}
+
+func accountProductDirName(repository *Repository, accountKey AccountKey, productId ProductId) string {
+	return accountProductsDirName(repository, accountKey) + string(productId) + pathSeparator
+}
+
+func accountProductDataFileName(repository *Repository, accountKey AccountKey, productId ProductId) string {
+	return accountProductDirName(repository, accountKey, productId) + "data" + jsonExtension
+}
+
+func accountProductImageFileName(repository *Repository, accountKey AccountKey, productId ProductId) string {
+	return accountProductDirName(repository, accountKey, productId) + "image"
+}
+
+func accountLedgerFileName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "ledger" + jsonExtension
+}
+
+func accountLedgerEntriesFileName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "ledger" + csvExtension
+}
+
+func accountWithdrawalsDirName(repository *Repository, accountKey AccountKey) string {
+	return accountDirName(repository, accountKey) + "withdrawals" + pathSeparator
+}
+
+func accountWithdrawalDirName(repository *Repository, accountKey AccountKey, withdrawalId AccountWithdrawalId) string {
+	return accountWithdrawalsDirName(repository, accountKey) + string(withdrawalId) + pathSeparator
+}
+
+func accountWithdrawalDataFileName(repository *Repository, accountKey AccountKey, withdrawalId AccountWithdrawalId) string {
+	return accountWithdrawalDirName(repository, accountKey, withdrawalId) + "data" + jsonExtension
+}
+
+func accountWithdrawalFileName(repository *Repository, accountKey AccountKey, withdrawalId AccountWithdrawalId) string {
+	return accountWithdrawalDirName(repository, accountKey, withdrawalId) + "withdrawal" + jsonExtension
+}
+
 func eventDirName(repository *Repository, eventId EventId) string {
 	return repository.dataDir + eventsDirName + string(eventId) + pathSeparator
 }
@@ -306,15 +843,47 @@ func raffleWinnersFileName(repository *Repository, raffleId RaffleId) string {
 	return raffleDirName(repository, raffleId) + "winners" + csvExtension
 }
 
+func raffleSkippedTicketsFileName(repository *Repository, raffleId RaffleId) string {
+	return raffleDirName(repository, raffleId) + "skipped" + csvExtension
+}
+
 func raffleWithdrawalFileName(repository *Repository, raffleId RaffleId) string {
-	return raffleDirName(repository, raffleId) + "withdrawal" + csvExtension
+	return raffleDirName(repository, raffleId) + "withdrawal" + jsonExtension
 }
 
 func raffleLockFileName(repository *Repository, raffleId RaffleId) string {
 	return raffleDirName(repository, raffleId) + ".lock"
 }
 
-func randomId[T EventId | RaffleId]() (T, error) {
+func voucherBatchDirName(repository *Repository, batchId VoucherBatchId) string {
+	return repository.dataDir + vouchersDirName + string(batchId) + pathSeparator
+}
+
+func voucherBatchDataFileName(repository *Repository, batchId VoucherBatchId) string {
+	return voucherBatchDirName(repository, batchId) + "data" + jsonExtension
+}
+
+func voucherBatchVouchersFileName(repository *Repository, batchId VoucherBatchId) string {
+	return voucherBatchDirName(repository, batchId) + "vouchers" + csvExtension
+}
+
+func voucherWithdrawalsDirName(repository *Repository, batchId VoucherBatchId) string {
+	return voucherBatchDirName(repository, batchId) + "withdrawals" + pathSeparator
+}
+
+func voucherWithdrawalFileName(repository *Repository, batchId VoucherBatchId, voucher Voucher) string {
+	return voucherWithdrawalsDirName(repository, batchId) + voucher.String() + jsonExtension
+}
+
+func cardDirName(repository *Repository, cardId CardId) string {
+	return repository.dataDir + cardsDirName + string(cardId) + pathSeparator
+}
+
+func cardDataFileName(repository *Repository, cardId CardId) string {
+	return cardDirName(repository, cardId) + "data" + jsonExtension
+}
+
+func randomId[T EventId | RaffleId | VoucherBatchId | AccountWithdrawalId | ProductId | ShiftId | CardId]() (T, error) {
 	random := make([]byte, 5)
 	if _, err := rand.Read(random); err != nil {
 		return "", err
@@ -380,7 +949,15 @@ func appendValue[T fmt.Stringer](fileName string, value T) error {
 }
 
 func writeValues[T fmt.Stringer](fileName string, values []T) error {
-	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_EXCL|os.O_CREATE, 0644)
+	return saveValues(fileName, os.O_EXCL, values)
+}
+
+func replaceValues[T fmt.Stringer](fileName string, values []T) error {
+	return saveValues(fileName, os.O_TRUNC, values)
+}
+
+func saveValues[T fmt.Stringer](fileName string, flag int, values []T) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|flag, 0644)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ShiftId string
+
+type Shift struct {
+	Id     ShiftId   `json:"id"`
+	Opener UserKey   `json:"opener"`
+	Opened time.Time `json:"opened"`
+	Closer UserKey   `json:"closer"`
+	Closed time.Time `json:"closed"`
+}
+
+func (shift *Shift) IsOpen() bool {
+	return shift.Closed.IsZero()
+}
+
+func sortShifts(shifts []*Shift) []*Shift {
+	sort.Slice(shifts, func(i, j int) bool {
+		return shifts[i].Opened.After(shifts[j].Opened)
+	})
+	return shifts
+}
+
+type ShiftInvoice struct {
+	paymentHash PaymentHash
+	amount      float64
+	rate        float64
+}
+
+func parseShiftInvoice(value string) ShiftInvoice {
+	paymentHash, rest, _ := strings.Cut(value, ",")
+	amount, rate, _ := strings.Cut(rest, ",")
+	fiatAmount, _ := strconv.ParseFloat(amount, 64)
+	exchangeRate, _ := strconv.ParseFloat(rate, 64)
+	return ShiftInvoice{PaymentHash(paymentHash), fiatAmount, exchangeRate}
+}
+
+func (invoice ShiftInvoice) String() string {
+	return string(invoice.paymentHash) + "," + strconv.FormatFloat(invoice.amount, 'f', -1, 64) + "," +
+		strconv.FormatFloat(invoice.rate, 'f', -1, 64)
+}
+
+// fiatAmount converts settled sats to the account currency at the rate the invoice was issued at;
+// invoices recorded without a rate fall back to the entered amount.
+func (invoice ShiftInvoice) fiatAmount(sats int64) float64 {
+	if invoice.rate <= 0 {
+		return invoice.amount
+	}
+	return float64(sats) * invoice.rate / satsPerBitcoin
+}
+
+type ZReport struct {
+	AccountKey      AccountKey
+	Currency        Currency
+	Shift           *Shift
+	InvoicesIssued  int
+	InvoicesSettled int
+	TotalSats       int64
+	TotalFiat       float64
+	TotalTips       float64
+	ProductSales    []ProductSales
+}
+
+func newZReport(accountKey AccountKey, currency Currency, shift *Shift, invoices []ShiftInvoice,
+	getInvoice func(PaymentHash) *Invoice, payments []OnChainPayment, tips []InvoiceTip, items []InvoiceItem) *ZReport {
+
+	paidOnChain := map[PaymentHash]int64{}
+	for _, payment := range payments {
+		if payment.IsPaid {
+			paidOnChain[payment.PaymentHash] = payment.Received
+		}
+	}
+
+	report := ZReport{AccountKey: accountKey, Currency: currency, Shift: shift, InvoicesIssued: len(invoices)}
+	settledInvoices := map[PaymentHash]bool{}
+	for _, shiftInvoice := range invoices {
+		var received int64
+		if invoice := getInvoice(shiftInvoice.paymentHash); invoice != nil && invoice.isSettled() {
+			received = invoice.amount
+		} else if amount, paid := paidOnChain[shiftInvoice.paymentHash]; paid {
+			received = amount
+		} else {
+			continue
+		}
+		settledInvoices[shiftInvoice.paymentHash] = true
+		report.InvoicesSettled++
+		report.TotalSats += received
+		report.TotalFiat += shiftInvoice.fiatAmount(received)
+	}
+	for _, tip := range tips {
+		if settledInvoices[tip.paymentHash] {
+			report.TotalTips += tip.tip
+		}
+	}
+	report.TotalFiat = roundFiat(report.TotalFiat)
+	report.TotalTips = roundFiat(report.TotalTips)
+	report.ProductSales = getProductSales(items, func(paymentHash PaymentHash) bool {
+		return settledInvoices[paymentHash]
+	})
+
+	return &report
+}
+
+func (report *ZReport) summary() [][]string {
+	return [][]string{
+		{"Account", string(report.AccountKey)},
+		{"Opened", report.Shift.Opened.Format(time.RFC3339), string(report.Shift.Opener)},
+		{"Closed", report.Shift.Closed.Format(time.RFC3339), string(report.Shift.Closer)},
+		{"Invoices issued", strconv.Itoa(report.InvoicesIssued)},
+		{"Invoices settled", strconv.Itoa(report.InvoicesSettled)},
+		{"Total sats", strconv.FormatInt(report.TotalSats, 10)},
+		{"Total " + currencyCode(report.Currency), formatFiat(report.TotalFiat)},
+		{"Tips " + currencyCode(report.Currency), formatFiat(report.TotalTips)},
+	}
+}
+
+func (report *ZReport) csv() []byte {
+	var csvData bytes.Buffer
+	writer := csv.NewWriter(&csvData)
+	_ = writer.WriteAll(report.summary())
+	_ = writer.Write([]string{})
+	_ = writer.Write([]string{"Product", "Quantity", "Amount " + currencyCode(report.Currency)})
+	for _, sales := range report.ProductSales {
+		_ = writer.Write([]string{sales.Name, strconv.Itoa(sales.Quantity), formatFiat(sales.Amount)})
+	}
+	writer.Flush()
+
+	return csvData.Bytes()
+}
+
+func (report *ZReport) pdf() []byte {
+	const margin, fontSize, lineHeight, columns = 56.0, 10.0, 14.0, 80
+
+	document := newPdfDocument()
+	page := document.addPage(pdfA4Width, pdfA4Height)
+	y := margin
+	writeLine := func(text string, bold bool) {
+		if y+lineHeight > pdfA4Height-margin {
+			page = document.addPage(pdfA4Width, pdfA4Height)
+			y = margin
+		}
+		page.text(margin, y, fontSize, bold, text)
+		y += lineHeight
+	}
+
+	writeLine("Z-REPORT", true)
+	writeLine("", false)
+	for _, row := range report.summary() {
+		label, value := row[0], strings.Join(row[1:], " ")
+		writeLine(reportLine(label, value, columns), false)
+	}
+	if len(report.ProductSales) > 0 {
+		writeLine("", false)
+		writeLine(reportLine("Product", leftPad("Quantity", 10)+leftPad("Amount", 12), columns), true)
+		for _, sales := range report.ProductSales {
+			value := leftPad(strconv.Itoa(sales.Quantity), 10) + leftPad(formatFiat(sales.Amount), 12)
+			writeLine(reportLine(sales.Name, value, columns), false)
+		}
+	}
+
+	return document.bytes()
+}
+
+func reportLine(label string, value string, columns int) string {
+	labelRunes := []rune(label)
+	if maxLength := max(columns-len([]rune(value))-1, 1); len(labelRunes) > maxLength {
+		labelRunes = labelRunes[:maxLength]
+	}
+	padding := columns - len(labelRunes) - len([]rune(value))
+	return string(labelRunes) + strings.Repeat(" ", max(padding, 1)) + value
+}
+
+func leftPad(value string, width int) string {
+	return strings.Repeat(" ", max(width-len([]rune(value)), 0)) + value
+}
+
+func formatFiat(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestShiftInvoice(t *testing.T) {
+	invoice := ShiftInvoice{"d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d", 12.5, 1_500_000}
+	assert.Equal(t, invoice, parseShiftInvoice(invoice.String()))
+
+	legacyInvoice := parseShiftInvoice("d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d,12.5")
+	assert.Equal(t, ShiftInvoice{invoice.paymentHash, 12.5, 0}, legacyInvoice)
+	assert.Equal(t, 12.5, legacyInvoice.fiatAmount(1_000))
+	assert.Equal(t, 15.0, invoice.fiatAmount(1_000))
+}
+
+func TestZReport(t *testing.T) {
+	shift := &Shift{
+		Id:     "4dJLpTrb7B",
+		Opener: "alice",
+		Opened: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		Closer: "bob",
+		Closed: time.Date(2024, 5, 1, 16, 0, 0, 0, time.UTC),
+	}
+	invoices := map[PaymentHash]*Invoice{
+		"a": {amount: 10_000, settleDate: shift.Opened.Add(time.Hour)},
+		"b": {amount: 20_000},
+		"c": {amount: 5_000, settleDate: shift.Opened.Add(2 * time.Hour)},
+	}
+	getInvoice := func(paymentHash PaymentHash) *Invoice {
+		return invoices[paymentHash]
+	}
+	shiftInvoices := []ShiftInvoice{{"a", 11, 120_000}, {"b", 22, 110_000}, {"c", 5.5, 0}}
+	tips := []InvoiceTip{{"a", "alice", 10, 1}, {"b", "alice", 20, 2}, {"x", "bob", 10, 1}}
+	items := []InvoiceItem{{"c", "cake", 1, 5.5, "Cake, cheese"}, {"x", "cake", 1, 5.5, "Cake, cheese"}}
+
+	report := newZReport("satoshi", CZK, shift, shiftInvoices, getInvoice, nil, tips, items)
+	assert.Equal(t, 3, report.InvoicesIssued)
+	assert.Equal(t, 2, report.InvoicesSettled)
+	assert.Equal(t, int64(15_000), report.TotalSats)
+	assert.Equal(t, 17.5, report.TotalFiat)
+	assert.Equal(t, 1.0, report.TotalTips)
+	assert.Equal(t, []ProductSales{{"Cake, cheese", 1, 5.5}}, report.ProductSales)
+
+	assert.Equal(t, "Account,satoshi\n"+
+		"Opened,2024-05-01T08:00:00Z,alice\n"+
+		"Closed,2024-05-01T16:00:00Z,bob\n"+
+		"Invoices issued,3\n"+
+		"Invoices settled,2\n"+
+		"Total sats,15000\n"+
+		"Total CZK,17.50\n"+
+		"Tips CZK,1.00\n"+
+		"\n"+
+		"Product,Quantity,Amount CZK\n"+
+		"\"Cake, cheese\",1,5.50\n", string(report.csv()))
+
+	pdfData := report.pdf()
+	assert.True(t, bytes.HasPrefix(pdfData, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdfData, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdfData), "(Z-REPORT)")
+}
+
+func TestZReportOnChain(t *testing.T) {
+	shift := &Shift{Id: "4dJLpTrb7B", Opener: "alice", Opened: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)}
+	invoices := map[PaymentHash]*Invoice{
+		"a": {amount: 10_000, settleDate: shift.Opened.Add(time.Hour)},
+		"b": {amount: 20_000},
+		"c": {amount: 40_000},
+	}
+	getInvoice := func(paymentHash PaymentHash) *Invoice {
+		return invoices[paymentHash]
+	}
+	payments := []OnChainPayment{
+		{PaymentHash: "b", Received: 20_500, IsConfirmed: true, IsPaid: true},
+		{PaymentHash: "c", Received: 40_000, IsConfirmed: false, IsPaid: false},
+	}
+	shiftInvoices := []ShiftInvoice{{"a", 10, 0}, {"b", 20, 0}, {"c", 40, 0}}
+	tips := []InvoiceTip{{"b", "alice", 20, 2}, {"c", "alice", 40, 4}}
+	items := []InvoiceItem{{"b", "cake", 2, 9, "Cake"}, {"c", "cake", 4, 9, "Cake"}}
+
+	report := newZReport("satoshi", CZK, shift, shiftInvoices, getInvoice, payments, tips, items)
+	assert.Equal(t, 3, report.InvoicesIssued)
+	assert.Equal(t, 2, report.InvoicesSettled)
+	assert.Equal(t, int64(30_500), report.TotalSats)
+	assert.Equal(t, 30.0, report.TotalFiat)
+	assert.Equal(t, 2.0, report.TotalTips)
+	assert.Equal(t, []ProductSales{{"Cake", 2, 18}}, report.ProductSales)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const splitPeriod = 1 * time.Minute
+
+type AccountSplit struct {
+	Account AccountKey
+	Target  string
+	Percent float32
+	MaxFee  uint32 `yaml:"max-fee"`
+}
+
+func (split *AccountSplit) isExternal() bool {
+	return split.Target != ""
+}
+
+func (split *AccountSplit) beneficiary() string {
+	if split.isExternal() {
+		return split.Target
+	}
+	return string(split.Account)
+}
+
+func (split *AccountSplit) share(amount int64) int64 {
+	return int64(float64(amount) * float64(split.Percent) / 100)
+}
+
+type AccountLedger struct {
+	Since time.Time `json:"since"`
+}
+
+type LedgerEntry struct {
+	paymentHash PaymentHash
+	amount      int64
+	created     time.Time
+	account     AccountKey
+	target      string
+}
+
+func parseLedgerEntry(value string) LedgerEntry {
+	values := strings.SplitN(value, ",", 5)
+	for len(values) < 5 {
+		values = append(values, "")
+	}
+	amount, _ := strconv.ParseInt(values[1], 10, 64)
+	created, _ := strconv.ParseInt(values[2], 10, 64)
+	return LedgerEntry{PaymentHash(values[0]), amount, time.Unix(created, 0), AccountKey(values[3]), values[4]}
+}
+
+func (entry LedgerEntry) String() string {
+	amount, created := strconv.FormatInt(entry.amount, 10), strconv.FormatInt(entry.created.Unix(), 10)
+	return string(entry.paymentHash) + "," + amount + "," + created + "," + string(entry.account) + "," + entry.target
+}
+
+func (entry LedgerEntry) beneficiary() string {
+	if entry.target != "" {
+		return entry.target
+	}
+	return string(entry.account)
+}
+
+type SplitSummary struct {
+	Beneficiary string
+	IsExternal  bool
+	Percent     float32
+	Amount      int64
+}
+
+type SplitService struct {
+	repository        *Repository
+	lndClient         *LndClient
+	forwardingService *ForwardingService
+}
+
+func newSplitService(accounts map[AccountKey]Account, repository *Repository, lndClient *LndClient,
+	forwardingService *ForwardingService) *SplitService {
+
+	service := SplitService{
+		repository:        repository,
+		lndClient:         lndClient,
+		forwardingService: forwardingService,
+	}
+
+	for accountKey, account := range accounts {
+		if len(account.Splits) > 0 {
+			go func(accountKey AccountKey, splits []AccountSplit) {
+				for true {
+					service.split(accountKey, splits)
+					time.Sleep(splitPeriod)
+				}
+			}(accountKey, account.Splits)
+		}
+	}
+
+	return &service
+}
+
+func (service *SplitService) split(accountKey AccountKey, splits []AccountSplit) {
+	ledger := service.repository.getAccountLedger(accountKey)
+	if ledger == nil {
+		ledger = &AccountLedger{Since: time.Now()}
+		if err := service.repository.createAccountLedger(accountKey, ledger); err != nil {
+			log.Println("error creating ledger:", err)
+		}
+		return
+	}
+
+	for _, invoice := range getUnsplitInvoices(service.repository, service.lndClient, accountKey, ledger) {
+		for _, split := range splits {
+			entry := LedgerEntry{invoice.paymentHash, split.share(invoice.amount), time.Now(), split.Account, split.Target}
+			if err := service.repository.addAccountLedgerEntry(accountKey, entry); err != nil {
+				log.Println("error adding ledger entry:", err)
+			}
+		}
+	}
+
+	for _, split := range splits {
+		if split.isExternal() {
+			service.forwardShare(accountKey, split)
+		}
+	}
+}
+
+// getUnsplitInvoices returns invoices settled since the ledger was created and not split yet.
+func getUnsplitInvoices(repository *Repository, lndClient *LndClient, accountKey AccountKey,
+	ledger *AccountLedger) []*Invoice {
+
+	splitInvoices := map[PaymentHash]bool{}
+	for _, entry := range repository.getAccountLedgerEntries(accountKey) {
+		splitInvoices[entry.paymentHash] = true
+	}
+
+	var invoices []*Invoice
+	for _, paymentHash := range repository.getAllAccountInvoices(accountKey) {
+		if splitInvoices[paymentHash] {
+			continue
+		}
+		invoice := lndClient.getInvoice(paymentHash)
+		if invoice == nil || !invoice.isSettled() || invoice.settleDate.Before(ledger.Since) {
+			continue
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices
+}
+
+func (service *SplitService) forwardShare(accountKey AccountKey, split AccountSplit) {
+	var owed int64
+	for _, entry := range service.repository.getAccountLedgerEntries(accountKey) {
+		if entry.target == split.Target {
+			owed += entry.amount
+		}
+	}
+	for _, withdrawal := range service.repository.getAccountWithdrawals(accountKey) {
+		if withdrawal.Split && withdrawal.Target == split.Target && !withdrawal.Canceled {
+			owed -= withdrawal.Amount
+		}
+	}
+	if owed <= int64(split.MaxFee) {
+		return
+	}
+
+	withdrawal := AccountWithdrawal{
+		Target:  split.Target,
+		Amount:  owed,
+		MaxFee:  int64(split.MaxFee),
+		Split:   true,
+		Created: time.Now(),
+	}
+	if err := service.repository.createAccountWithdrawal(accountKey, &withdrawal); err != nil {
+		log.Println("error creating split forward:", err)
+		return
+	}
+
+	service.forwardingService.pay(accountKey, &withdrawal)
+}
+
+func getSplitSummaries(splits []AccountSplit, entries []LedgerEntry) []SplitSummary {
+	amounts := map[string]int64{}
+	for _, entry := range entries {
+		amounts[entry.beneficiary()] += entry.amount
+	}
+
+	var summaries []SplitSummary
+	for _, split := range splits {
+		beneficiary := split.beneficiary()
+		summaries = append(summaries, SplitSummary{
+			Beneficiary: beneficiary,
+			IsExternal:  split.isExternal(),
+			Percent:     split.Percent,
+			Amount:      amounts[beneficiary],
+		})
+	}
+
+	return summaries
+}
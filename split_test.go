@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/hashicorp/golang-lru/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAccountSplit(t *testing.T) {
+	internal := AccountSplit{Account: "barista", Percent: 12.5}
+	assert.False(t, internal.isExternal())
+	assert.Equal(t, "barista", internal.beneficiary())
+	assert.Equal(t, int64(262), internal.share(2_100))
+
+	external := AccountSplit{Target: "satoshi@nakamoto.example", Percent: 30}
+	assert.True(t, external.isExternal())
+	assert.Equal(t, "satoshi@nakamoto.example", external.beneficiary())
+	assert.Equal(t, int64(630), external.share(2_100))
+}
+
+func TestLedgerEntry(t *testing.T) {
+	paymentHash := PaymentHash("d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d")
+	internal := LedgerEntry{paymentHash, 262, time.Unix(1700000000, 0), "barista", ""}
+	assert.Equal(t, string(paymentHash)+",262,1700000000,barista,", internal.String())
+	assert.Equal(t, internal, parseLedgerEntry(internal.String()))
+	assert.Equal(t, "barista", internal.beneficiary())
+
+	external := LedgerEntry{paymentHash, 630, time.Unix(1700000021, 0), "", "satoshi@nakamoto.example"}
+	assert.Equal(t, external, parseLedgerEntry(external.String()))
+	assert.Equal(t, "satoshi@nakamoto.example", external.beneficiary())
+}
+
+func TestGetSplitSummaries(t *testing.T) {
+	splits := []AccountSplit{{Account: "barista", Percent: 10}, {Target: "satoshi@nakamoto.example", Percent: 30}}
+	entries := []LedgerEntry{
+		{amount: 210, account: "barista"},
+		{amount: 630, target: "satoshi@nakamoto.example"},
+		{amount: 21, account: "barista"},
+	}
+	assert.Equal(t, []SplitSummary{
+		{Beneficiary: "barista", Percent: 10, Amount: 231},
+		{Beneficiary: "satoshi@nakamoto.example", IsExternal: true, Percent: 30, Amount: 630},
+	}, getSplitSummaries(splits, entries))
+}
+
+func TestSplitService(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	invoices, _ := lru.New[PaymentHash, Invoice](8)
+	lndClient := &LndClient{invoices: invoices}
+	withdrawalService := newWithdrawalService(
+		WithdrawalConfig{FeePercent: 0, RequestExpiry: 1 * time.Minute}, repository, nil,
+	)
+	splits := []AccountSplit{{Account: "barista", Percent: 10}, {Target: "satoshi@nakamoto.example", Percent: 30, MaxFee: 100}}
+	accounts := map[AccountKey]Account{"cafe": {Splits: splits}}
+	accountService := newAccountService(accounts, repository, lndClient, withdrawalService, newOnChainService(repository, nil))
+	service := newSplitService(nil, repository, lndClient, nil)
+
+	assert.Nil(t, repository.getAccountLedger("cafe"))
+	service.split("cafe", splits)
+	assert.NotNil(t, repository.getAccountLedger("cafe"))
+
+	invoice := Invoice{
+		paymentHash: "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d",
+		amount:      210,
+		settleDate:  time.Now().Add(time.Second),
+	}
+	invoices.Add(invoice.paymentHash, invoice)
+	assert.NoError(t, repository.addAccountInvoice("cafe", &invoice))
+	assert.Equal(t, int64(126), accountService.getBalance("cafe"))
+	assert.Equal(t, int64(0), accountService.getBalance("barista"))
+
+	service.split("cafe", splits)
+	assert.Equal(t, []LedgerEntry{
+		{invoice.paymentHash, 21, time.Unix(0, 0), "barista", ""},
+		{invoice.paymentHash, 63, time.Unix(0, 0), "", "satoshi@nakamoto.example"},
+	}, withoutCreated(repository.getAccountLedgerEntries("cafe")))
+	assert.Empty(t, repository.getAccountWithdrawals("cafe"))
+
+	service.split("cafe", splits)
+	assert.Len(t, repository.getAccountLedgerEntries("cafe"), 2)
+
+	assert.Equal(t, int64(126), accountService.getBalance("cafe"))
+	assert.Equal(t, int64(21), accountService.getBalance("barista"))
+	assert.Equal(t, map[AccountKey]int64{"cafe": 21}, accountService.getIncomingSplits("barista"))
+}
+
+func withoutCreated(entries []LedgerEntry) []LedgerEntry {
+	for i := range entries {
+		entries[i].created = time.Unix(0, 0)
+	}
+	return entries
+}
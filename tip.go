@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const percentSuffix = "%"
+
+type TipPreset string
+
+func (preset TipPreset) isPercent() bool {
+	return strings.HasSuffix(string(preset), percentSuffix)
+}
+
+func (preset TipPreset) value() (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(string(preset), percentSuffix), 64)
+}
+
+func (preset TipPreset) isValid() bool {
+	value, err := preset.value()
+	if err != nil || value <= 0 {
+		return false
+	}
+	if preset.isPercent() {
+		return value <= 100
+	}
+	return value < 1_000_000
+}
+
+func (preset TipPreset) amount(base float64) float64 {
+	value, _ := preset.value()
+	if preset.isPercent() {
+		value = base * value / 100
+	}
+	return roundFiat(value)
+}
+
+type InvoiceTip struct {
+	paymentHash PaymentHash
+	user        UserKey
+	amount      float64
+	tip         float64
+}
+
+func parseInvoiceTip(value string) InvoiceTip {
+	values := strings.SplitN(value, ",", 4)
+	for len(values) < 4 {
+		values = append(values, "")
+	}
+	amount, _ := strconv.ParseFloat(values[2], 64)
+	tip, _ := strconv.ParseFloat(values[3], 64)
+	return InvoiceTip{PaymentHash(values[0]), UserKey(values[1]), amount, tip}
+}
+
+func (tip InvoiceTip) String() string {
+	amount, tipAmount := strconv.FormatFloat(tip.amount, 'f', -1, 64), strconv.FormatFloat(tip.tip, 'f', -1, 64)
+	return string(tip.paymentHash) + "," + string(tip.user) + "," + amount + "," + tipAmount
+}
+
+type TipSummary struct {
+	User       UserKey
+	Count      int
+	TipsCount  int
+	BaseAmount float64
+	TipsAmount float64
+}
+
+func getTipSummaries(tips []InvoiceTip, settled func(PaymentHash) bool) []TipSummary {
+	summariesByUser := map[UserKey]*TipSummary{}
+	for _, tip := range tips {
+		if !settled(tip.paymentHash) {
+			continue
+		}
+		summary, exists := summariesByUser[tip.user]
+		if !exists {
+			summary = &TipSummary{User: tip.user}
+			summariesByUser[tip.user] = summary
+		}
+		summary.Count++
+		summary.BaseAmount += tip.amount
+		if tip.tip > 0 {
+			summary.TipsCount++
+			summary.TipsAmount += tip.tip
+		}
+	}
+
+	var summaries []TipSummary
+	for _, summary := range summariesByUser {
+		summaries = append(summaries, *summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].User < summaries[j].User
+	})
+	return summaries
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTipPreset(t *testing.T) {
+	assert.True(t, TipPreset("10%").isValid())
+	assert.True(t, TipPreset("2.5").isValid())
+	assert.False(t, TipPreset("").isValid())
+	assert.False(t, TipPreset("0%").isValid())
+	assert.False(t, TipPreset("120%").isValid())
+	assert.False(t, TipPreset("-2").isValid())
+	assert.False(t, TipPreset("ten").isValid())
+
+	assert.Equal(t, 1.23, TipPreset("10%").amount(12.34))
+	assert.Equal(t, 2.5, TipPreset("2.5").amount(12.34))
+	assert.Equal(t, 0.0, TipPreset("").amount(12.34))
+}
+
+func TestInvoiceTip(t *testing.T) {
+	tip := InvoiceTip{
+		paymentHash: "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d",
+		user:        "alice",
+		amount:      12.34,
+		tip:         1.23,
+	}
+	assert.Equal(t, tip, parseInvoiceTip(tip.String()))
+}
+
+func TestGetTipSummaries(t *testing.T) {
+	tips := []InvoiceTip{
+		{"a", "bob", 10, 1},
+		{"b", "alice", 20, 0},
+		{"c", "alice", 30, 3},
+		{"d", "alice", 40, 4},
+	}
+	summaries := getTipSummaries(tips, func(paymentHash PaymentHash) bool {
+		return paymentHash != "d"
+	})
+	assert.Equal(t, []TipSummary{{"alice", 2, 1, 50, 3}, {"bob", 1, 1, 10, 1}}, summaries)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"github.com/fiatjaf/go-lnurl"
+	"sort"
+	"sync"
+	"time"
+)
+
+type VoucherBatchId string
+
+type VoucherBatch struct {
+	Id         VoucherBatchId `json:"-"`
+	Owner      UserKey        `json:"owner"`
+	IsMine     bool           `json:"-"`
+	AccountKey AccountKey     `json:"accountKey" binding:"required"`
+	Title      string         `json:"title" binding:"min=1,max=50"`
+	Amount     int64          `json:"amount" binding:"min=1,max=1000000"`
+	Count      int            `json:"count" binding:"min=1,max=100"`
+	Created    time.Time      `json:"created"`
+}
+
+func (batch *VoucherBatch) total() int64 {
+	return batch.Amount * int64(batch.Count)
+}
+
+type Voucher string
+
+func toVoucher(value string) Voucher {
+	return Voucher(value)
+}
+
+func (voucher Voucher) String() string {
+	return string(voucher)
+}
+
+type VoucherStatus struct {
+	K1         string
+	Ordinal    int
+	Withdrawal *Withdrawal
+}
+
+func (status VoucherStatus) IsRedeemed() bool {
+	return !isWithdrawable(status.Withdrawal)
+}
+
+type VoucherService struct {
+	repository        *Repository
+	accountService    *AccountService
+	withdrawalService *WithdrawalService
+	batchIds          map[Voucher]VoucherBatchId
+	mutex             sync.RWMutex
+}
+
+func newVoucherService(repository *Repository, accountService *AccountService,
+	withdrawalService *WithdrawalService) *VoucherService {
+	batchIds := map[Voucher]VoucherBatchId{}
+	for _, batch := range repository.getVoucherBatches() {
+		for _, voucher := range repository.getVouchers(batch) {
+			batchIds[voucher] = batch.Id
+		}
+	}
+
+	return &VoucherService{
+		repository:        repository,
+		accountService:    accountService,
+		withdrawalService: withdrawalService,
+		batchIds:          batchIds,
+	}
+}
+
+func (service *VoucherService) createBatch(batch *VoucherBatch) error {
+	vouchers := make([]Voucher, batch.Count)
+	for i := range vouchers {
+		vouchers[i] = Voucher(lnurl.RandomK1())
+	}
+
+	if err := service.accountService.createVoucherBatch(batch, vouchers); err != nil {
+		return err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	for _, voucher := range vouchers {
+		service.batchIds[voucher] = batch.Id
+	}
+
+	return nil
+}
+
+func (service *VoucherService) getVouchers(batch *VoucherBatch) []VoucherStatus {
+	var vouchers []VoucherStatus
+	for i, voucher := range service.repository.getVouchers(batch) {
+		vouchers = append(vouchers, VoucherStatus{
+			K1:      voucher.String(),
+			Ordinal: i + 1,
+			Withdrawal: service.withdrawalService.getWithdrawal(
+				service.repository.getVoucherWithdrawalFileName(batch, voucher),
+			),
+		})
+	}
+
+	return vouchers
+}
+
+func (service *VoucherService) getWithdrawalRequest(k1 string) *WithdrawalRequest {
+	voucher := Voucher(k1)
+
+	service.mutex.RLock()
+	batchId, voucherExists := service.batchIds[voucher]
+	service.mutex.RUnlock()
+	if !voucherExists {
+		return nil
+	}
+
+	batch := service.repository.getVoucherBatch(batchId)
+	if batch == nil {
+		return nil
+	}
+
+	fileName := service.repository.getVoucherWithdrawalFileName(batch, voucher)
+	if !isWithdrawable(service.withdrawalService.getWithdrawal(fileName)) {
+		return nil
+	}
+
+	return service.withdrawalService.newRequest(fileName, batch.Amount, batch.Title, batch.AccountKey)
+}
+
+func sortVoucherBatches(batches []*VoucherBatch) []*VoucherBatch {
+	sort.Slice(batches, func(i, j int) bool {
+		batchI, batchJ := batches[i], batches[j]
+		if batchI.IsMine == batchJ.IsMine {
+			return batchI.Created.After(batchJ.Created)
+		}
+		return batchI.IsMine
+	})
+	return batches
+}
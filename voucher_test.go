@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestVoucherService(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	withdrawalService := newWithdrawalService(
+		WithdrawalConfig{FeePercent: 1, RequestExpiry: 1 * time.Minute}, repository, nil,
+	)
+	accountService := newAccountService(nil, repository, nil, withdrawalService, newOnChainService(repository, nil))
+	service := newVoucherService(repository, accountService, withdrawalService)
+
+	batch := VoucherBatch{AccountKey: "cafe", Title: "Free coffee", Amount: 2_100, Count: 3}
+	assert.ErrorIs(t, service.createBatch(&batch), errInsufficientBalance)
+
+	assert.NoError(t, repository.createAccountLedger("bakery", &AccountLedger{}))
+	assert.NoError(t, repository.addAccountLedgerEntry("bakery", LedgerEntry{amount: 7_000, account: "cafe"}))
+	assert.NoError(t, service.createBatch(&batch))
+	assert.Equal(t, int64(700), accountService.getBalance("cafe"))
+	assert.ErrorIs(t, service.createBatch(&VoucherBatch{AccountKey: "cafe", Amount: 701, Count: 1}), errInsufficientBalance)
+	assert.NotEmpty(t, batch.Id)
+	assert.Equal(t, int64(6_300), batch.total())
+
+	vouchers := service.getVouchers(&batch)
+	assert.Len(t, vouchers, 3)
+	for i, voucher := range vouchers {
+		assert.Regexp(t, "^[0-9a-f]{64}$", voucher.K1)
+		assert.Equal(t, i+1, voucher.Ordinal)
+		assert.False(t, voucher.IsRedeemed())
+	}
+
+	t.Run("getWithdrawalRequest", func(t *testing.T) {
+		restartedService := newVoucherService(repository, accountService, withdrawalService)
+		request := restartedService.getWithdrawalRequest(vouchers[0].K1)
+		assert.Equal(t, int64(2_079), request.amount)
+		assert.Equal(t, int64(21), request.feeLimit)
+		assert.Equal(t, "Free coffee", request.description)
+		assert.Equal(t, AccountKey("cafe"), request.accountKey)
+		assert.Nil(t, restartedService.getWithdrawalRequest("invalid"))
+	})
+
+	t.Run("redeemed", func(t *testing.T) {
+		request := service.getWithdrawalRequest(vouchers[1].K1)
+		withdrawal := Withdrawal{PaymentHash: "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d", State: WithdrawalSucceeded}
+		assert.NoError(t, repository.updateWithdrawal(request.fileName, &withdrawal))
+		assert.Nil(t, service.getWithdrawalRequest(vouchers[1].K1))
+		assert.True(t, service.getVouchers(&batch)[1].IsRedeemed())
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		request := service.getWithdrawalRequest(vouchers[2].K1)
+		withdrawal := Withdrawal{PaymentHash: "a5506d48d2e456769e4f557d440e8e502c815e6670bfb6a4299d136a52db54fd", State: WithdrawalFailed}
+		assert.NoError(t, repository.updateWithdrawal(request.fileName, &withdrawal))
+		assert.NotNil(t, service.getWithdrawalRequest(vouchers[2].K1))
+		assert.False(t, service.getVouchers(&batch)[2].IsRedeemed())
+	})
+}
+
+func TestSortVoucherBatches(t *testing.T) {
+	older, newer := time.Unix(1700000000, 0), time.Unix(1700000021, 0)
+	batches := []*VoucherBatch{{Title: "A", Created: older}, {Title: "B", Created: newer}, {Title: "C", IsMine: true}}
+	assert.Equal(t, []*VoucherBatch{{Title: "C", IsMine: true}, {Title: "B", Created: newer}, {Title: "A", Created: older}}, sortVoucherBatches(batches))
+}
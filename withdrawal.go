@@ -1,12 +1,19 @@
 package main
 
 import (
+	"errors"
 	"github.com/fiatjaf/go-lnurl"
 	"github.com/hashicorp/golang-lru/v2/expirable"
 	"log"
+	"sync"
 	"time"
 )
 
+var (
+	errAlreadyWithdrawn   = errors.New("already withdrawn")
+	errWithdrawalCanceled = errors.New("withdrawal canceled")
+)
+
 type WithdrawalConfig struct {
 	FeePercent    float32       `yaml:"fee-percent"`
 	RequestExpiry time.Duration `yaml:"request-expiry"`
@@ -17,14 +24,69 @@ type WithdrawalRequest struct {
 	amount      int64
 	feeLimit    int64
 	description string
+	accountKey  AccountKey
+	isCanceled  func() bool
+}
+
+type WithdrawalState string
+
+const (
+	WithdrawalPending   WithdrawalState = "pending"
+	WithdrawalInFlight  WithdrawalState = "in-flight"
+	WithdrawalSucceeded WithdrawalState = "succeeded"
+	WithdrawalFailed    WithdrawalState = "failed"
+)
+
+type Withdrawal struct {
+	PaymentHash   PaymentHash     `json:"paymentHash"`
+	Amount        int64           `json:"amount"`
+	FeeLimit      int64           `json:"feeLimit"`
+	Fee           int64           `json:"fee"`
+	State         WithdrawalState `json:"state"`
+	FailureReason string          `json:"failureReason,omitempty"`
+	Created       time.Time       `json:"created"`
+	Updated       time.Time       `json:"updated"`
+}
+
+func (withdrawal *Withdrawal) IsSucceeded() bool {
+	return withdrawal.State == WithdrawalSucceeded
+}
+
+func (withdrawal *Withdrawal) IsFailed() bool {
+	return withdrawal.State == WithdrawalFailed
+}
+
+func (withdrawal *Withdrawal) isFinal() bool {
+	return withdrawal.IsSucceeded() || withdrawal.IsFailed()
+}
+
+func (withdrawal *Withdrawal) update(payment *Payment) {
+	withdrawal.State = WithdrawalState(payment.status)
+	withdrawal.Fee = payment.fee
+	withdrawal.FailureReason = payment.failureReason
+	withdrawal.Updated = time.Now()
+}
+
+func (withdrawal *Withdrawal) fail(reason string) {
+	withdrawal.State = WithdrawalFailed
+	withdrawal.FailureReason = reason
+	withdrawal.Updated = time.Now()
+}
+
+func isWithdrawable(withdrawal *Withdrawal) bool {
+	return withdrawal == nil || withdrawal.IsFailed()
 }
 
 type WithdrawalService struct {
 	k1s        *expirable.LRU[string, *WithdrawalRequest]
 	feePercent float32
+	repository *Repository
+	lndClient  *LndClient
+	tracked    map[string]bool
+	mutex      sync.Mutex
 }
 
-func newWithdrawalService(config WithdrawalConfig) *WithdrawalService {
+func newWithdrawalService(config WithdrawalConfig, repository *Repository, lndClient *LndClient) *WithdrawalService {
 	feePercent, requestExpiry := config.FeePercent, config.RequestExpiry
 	if feePercent < 0 || feePercent > 10 {
 		log.Fatal("Withdrawal fee percent out of range: ", feePercent)
@@ -36,20 +98,32 @@ func newWithdrawalService(config WithdrawalConfig) *WithdrawalService {
 	return &WithdrawalService{
 		k1s:        expirable.NewLRU[string, *WithdrawalRequest](32, nil, requestExpiry),
 		feePercent: feePercent,
+		repository: repository,
+		lndClient:  lndClient,
+		tracked:    map[string]bool{},
 	}
 }
 
-func (service *WithdrawalService) createRequest(fileName string, amount int64, description string) string {
+func (service *WithdrawalService) createRequest(fileName string, amount int64, description string, accountKey AccountKey) string {
+	return service.addRequest(service.newRequest(fileName, amount, description, accountKey))
+}
+
+func (service *WithdrawalService) addRequest(request *WithdrawalRequest) string {
 	k1 := lnurl.RandomK1()
+	service.k1s.Add(k1, request)
+
+	return k1
+}
+
+func (service *WithdrawalService) newRequest(fileName string, amount int64, description string, accountKey AccountKey) *WithdrawalRequest {
 	fee := withdrawalFee(amount, service.feePercent)
-	service.k1s.Add(k1, &WithdrawalRequest{
+	return &WithdrawalRequest{
 		fileName:    fileName,
 		amount:      amount - fee,
 		feeLimit:    fee,
 		description: description,
-	})
-
-	return k1
+		accountKey:  accountKey,
+	}
 }
 
 func (service *WithdrawalService) getRequest(k1 string) *WithdrawalRequest {
@@ -63,6 +137,143 @@ func (service *WithdrawalService) removeRequest(k1 string) {
 	service.k1s.Remove(k1)
 }
 
+func (service *WithdrawalService) removeRequests(fileName string) {
+	for _, k1 := range service.k1s.Keys() {
+		if request, k1Valid := service.k1s.Peek(k1); k1Valid && request.fileName == fileName {
+			service.k1s.Remove(k1)
+		}
+	}
+}
+
+// cancel runs the given cancellation under the same lock withdrawals are started with,
+// so that a withdrawal is either canceled or started, never both.
+func (service *WithdrawalService) cancel(fileName string, cancel func() error) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if !isWithdrawable(service.repository.getWithdrawal(fileName)) || service.tracked[fileName] {
+		return errAlreadyWithdrawn
+	}
+	service.removeRequests(fileName)
+
+	return cancel()
+}
+
+func (service *WithdrawalService) withdraw(request *WithdrawalRequest, paymentRequest string, paymentHash PaymentHash) error {
+	withdrawal, err := service.startWithdrawal(request, paymentHash)
+	if err != nil {
+		return err
+	}
+
+	stream, err := service.lndClient.sendPayment(paymentRequest, request.feeLimit)
+	if err == nil {
+		err = service.processPaymentUpdate(request.fileName, withdrawal, stream)
+	}
+	if err != nil || withdrawal.isFinal() {
+		service.untrack(request.fileName) // unknown payment state gets resolved once tracked again
+	} else {
+		go service.trackPayment(request.fileName, withdrawal, stream)
+	}
+
+	if err == nil && withdrawal.IsFailed() {
+		return errors.New(withdrawal.FailureReason)
+	}
+	return err
+}
+
+func (service *WithdrawalService) startWithdrawal(request *WithdrawalRequest, paymentHash PaymentHash) (*Withdrawal, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if !isWithdrawable(service.repository.getWithdrawal(request.fileName)) || service.tracked[request.fileName] {
+		return nil, errAlreadyWithdrawn
+	}
+	if request.isCanceled != nil && request.isCanceled() {
+		return nil, errWithdrawalCanceled
+	}
+
+	now := time.Now()
+	withdrawal := Withdrawal{
+		PaymentHash: paymentHash,
+		Amount:      request.amount,
+		FeeLimit:    request.feeLimit,
+		State:       WithdrawalPending,
+		Created:     now,
+		Updated:     now,
+	}
+	if err := service.repository.updateWithdrawal(request.fileName, &withdrawal); err != nil {
+		return nil, err
+	}
+	service.tracked[request.fileName] = true
+
+	return &withdrawal, nil
+}
+
+func (service *WithdrawalService) getWithdrawal(fileName string) *Withdrawal {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	withdrawal := service.repository.getWithdrawal(fileName)
+	if withdrawal != nil && !withdrawal.isFinal() && !service.tracked[fileName] {
+		service.tracked[fileName] = true
+		go service.resumeTracking(fileName, *withdrawal) // e.g. after restart
+	}
+
+	return withdrawal
+}
+
+func (service *WithdrawalService) resumeTracking(fileName string, withdrawal Withdrawal) {
+	stream, err := service.lndClient.trackPayment(withdrawal.PaymentHash)
+	if err != nil {
+		log.Println("error tracking payment:", err)
+		service.untrack(fileName)
+		return
+	}
+
+	service.trackPayment(fileName, &withdrawal, stream)
+}
+
+func (service *WithdrawalService) trackPayment(fileName string, withdrawal *Withdrawal, stream PaymentStream) {
+	defer service.untrack(fileName)
+
+	for !withdrawal.isFinal() {
+		if err := service.processPaymentUpdate(fileName, withdrawal, stream); err != nil {
+			log.Println("error tracking payment:", err)
+			return
+		}
+	}
+}
+
+func (service *WithdrawalService) processPaymentUpdate(fileName string, withdrawal *Withdrawal, stream PaymentStream) error {
+	payment, err := stream()
+	if errors.Is(err, errPaymentNotFound) {
+		withdrawal.fail("payment not initiated")
+	} else if err != nil {
+		return err
+	} else {
+		withdrawal.update(payment)
+	}
+
+	service.updateWithdrawal(fileName, withdrawal)
+	return nil
+}
+
+func (service *WithdrawalService) updateWithdrawal(fileName string, withdrawal *Withdrawal) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if err := service.repository.updateWithdrawal(fileName, withdrawal); err != nil {
+		log.Println("error updating withdrawal:", err)
+	}
+}
+
+func (service *WithdrawalService) untrack(fileName string) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	delete(service.tracked, fileName)
+}
+
 func withdrawalFee(amount int64, feePercent float32) int64 {
 	return int64(float32(amount) * feePercent / 100)
 }
@@ -2,28 +2,91 @@ package main
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestWithdrawalService(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
 	service := newWithdrawalService(
-		WithdrawalConfig{FeePercent: 0.21, RequestExpiry: 1 * time.Minute},
+		WithdrawalConfig{FeePercent: 0.21, RequestExpiry: 1 * time.Minute}, repository, nil,
 	)
 
 	t.Run("createRequest", func(t *testing.T) {
-		k1 := service.createRequest("foo.csv", 21_000, "Sats")
-		request := WithdrawalRequest{fileName: "foo.csv", amount: 20_956, feeLimit: 44, description: "Sats"}
+		k1 := service.createRequest("foo.csv", 21_000, "Sats", "cafe")
+		request := WithdrawalRequest{fileName: "foo.csv", amount: 20_956, feeLimit: 44, description: "Sats", accountKey: "cafe"}
 		assert.Regexp(t, "^[0-9a-f]{64}$", k1)
 		assert.Equal(t, &request, service.getRequest(k1))
-		assert.NotEqual(t, k1, service.createRequest("bar.csv", 21, ""))
+		assert.NotEqual(t, k1, service.createRequest("bar.csv", 21, "", ""))
 	})
 
 	t.Run("removeRequest", func(t *testing.T) {
-		k1 := service.createRequest("bar.csv", 0, "")
+		k1 := service.createRequest("bar.csv", 0, "", "")
 		request := WithdrawalRequest{fileName: "bar.csv", amount: 0, feeLimit: 0}
 		assert.Equal(t, &request, service.getRequest(k1))
 		service.removeRequest(k1)
 		assert.Nil(t, service.getRequest(k1))
 	})
+
+	t.Run("startWithdrawal", func(t *testing.T) {
+		fileName := repository.dataDir + "withdrawal.json"
+		request := service.newRequest(fileName, 21_000, "Sats", "")
+		withdrawal, err := service.startWithdrawal(request, "d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d")
+		assert.NoError(t, err)
+		assert.Equal(t, WithdrawalPending, withdrawal.State)
+		assert.Equal(t, int64(20_956), withdrawal.Amount)
+		assert.Equal(t, int64(44), withdrawal.FeeLimit)
+		_, err = service.startWithdrawal(request, "a5506d48d2e456769e4f557d440e8e502c815e6670bfb6a4299d136a52db54fd")
+		assert.ErrorIs(t, err, errAlreadyWithdrawn)
+
+		withdrawal.update(&Payment{status: PaymentFailed, failureReason: "no route"})
+		service.updateWithdrawal(fileName, withdrawal)
+		service.untrack(fileName)
+		assert.Equal(t, withdrawal.PaymentHash, service.getWithdrawal(fileName).PaymentHash)
+		assert.Equal(t, "no route", service.getWithdrawal(fileName).FailureReason)
+
+		retriedWithdrawal, err := service.startWithdrawal(request, "a5506d48d2e456769e4f557d440e8e502c815e6670bfb6a4299d136a52db54fd")
+		assert.NoError(t, err)
+		assert.Equal(t, PaymentHash("a5506d48d2e456769e4f557d440e8e502c815e6670bfb6a4299d136a52db54fd"), retriedWithdrawal.PaymentHash)
+	})
+}
+
+func TestWithdrawal(t *testing.T) {
+	withdrawal := Withdrawal{State: WithdrawalPending}
+	assert.False(t, isWithdrawable(&withdrawal))
+	assert.True(t, isWithdrawable(nil))
+
+	withdrawal.update(&Payment{status: PaymentInFlight})
+	assert.Equal(t, WithdrawalInFlight, withdrawal.State)
+	assert.False(t, withdrawal.isFinal())
+
+	withdrawal.update(&Payment{status: PaymentSucceeded, fee: 3})
+	assert.True(t, withdrawal.IsSucceeded())
+	assert.Equal(t, int64(3), withdrawal.Fee)
+	assert.False(t, isWithdrawable(&withdrawal))
+
+	withdrawal.fail("payment not initiated")
+	assert.True(t, withdrawal.IsFailed())
+	assert.True(t, isWithdrawable(&withdrawal))
+}
+
+func TestLegacyWithdrawal(t *testing.T) {
+	repository := newRepository("", t.TempDir()+pathSeparator)
+	service := newWithdrawalService(WithdrawalConfig{RequestExpiry: 1 * time.Minute}, repository, nil)
+	raffle := Raffle{Title: "Lightning Raffle"}
+	assert.NoError(t, repository.createRaffle(&raffle))
+
+	fileName := repository.getRaffleWithdrawalFileName(&raffle)
+	paymentHash := PaymentHash("d643d24061a5410f96693978711071819a9700d38b006285246c8e227e32fd4d")
+	legacyFileName := strings.TrimSuffix(fileName, jsonExtension) + csvExtension
+	assert.NoError(t, writeValues(legacyFileName, []PaymentHash{paymentHash}))
+
+	withdrawal := service.getWithdrawal(fileName)
+	assert.Equal(t, paymentHash, withdrawal.PaymentHash)
+	assert.True(t, withdrawal.IsSucceeded())
+	assert.False(t, isWithdrawable(withdrawal))
+
+	_, err := service.startWithdrawal(service.newRequest(fileName, 21_000, raffle.Title, ""), paymentHash)
+	assert.ErrorIs(t, err, errAlreadyWithdrawn)
 }